@@ -9,7 +9,8 @@ import (
 	"github.com/miekg/dns"
 )
 
-const port = 53
+// port is DNS port of servers, it is changed by tests.
+var port = 53
 
 // Supported DNS queries types.
 const (
@@ -45,6 +46,17 @@ var (
 
 // Query returns DNS query result for the given name using given NS.
 func Query(name string, ns net.IP, qtype string) ([]string, error) {
+	in, _, err := Exchange(name, ns, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	return answers(in.Answer, qtype), nil
+}
+
+// Exchange sends DNS query for the given name to the given NS
+// and returns the full response and the query round trip time.
+func Exchange(name string, ns net.IP, qtype string) (*dns.Msg, time.Duration, error) {
 
 	msg := &dns.Msg{
 		MsgHdr: dns.MsgHdr{
@@ -60,73 +72,73 @@ func Query(name string, ns net.IP, qtype string) ([]string, error) {
 		},
 	}
 
-	in, _, err := Client.Exchange(msg, getAddr(ns))
-	if err != nil {
-		return nil, err
-	}
+	return Client.Exchange(msg, getAddr(ns))
+}
 
+// answers extracts answers of the given type from resource records.
+func answers(rrs []dns.RR, qtype string) []string {
 	res := make([]string, 0)
 
 	switch qtype {
 
 	case TypeA:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.A); ok {
 				res = append(res, t.A.String())
 			}
 		}
 
 	case TypeAAAA:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.AAAA); ok {
 				res = append(res, t.AAAA.String())
 			}
 		}
 
 	case TypeNS:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.NS); ok {
 				res = append(res, strings.Trim(t.Ns, "."))
 			}
 		}
 
 	case TypeMX:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.MX); ok {
 				res = append(res, strings.Trim(t.Mx, "."))
 			}
 		}
 
 	case TypeTXT:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.TXT); ok {
 				res = append(res, t.Txt...)
 			}
 		}
 
 	case TypeSRV:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.SRV); ok {
 				res = append(res, strings.Trim(t.Target, "."))
 			}
 		}
 
 	case TypeCNAME:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.CNAME); ok {
 				res = append(res, strings.Trim(t.Target, "."))
 			}
 		}
 
 	case TypePTR:
-		for _, a := range in.Answer {
+		for _, a := range rrs {
 			if t, ok := a.(*dns.PTR); ok {
 				res = append(res, strings.Trim(t.Ptr, "."))
 			}
 		}
 	}
 
-	return res, nil
+	return res
 }
 
 func getAddr(ip net.IP) string {
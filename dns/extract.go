@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/russtone/utils/iter"
+)
+
+const maxLineSize = 1024 * 1024
+
+var (
+	// Matches hostname candidates, e.g. "example.com", "a-1.b.example.co.uk".
+	// The last label must start with a letter to skip IPv4 addresses and numbers.
+	hostnameRegexp = regexp.MustCompile(`(?i)(?:[a-z0-9_](?:[a-z0-9_-]{0,61}[a-z0-9])?\.)+[a-z](?:[a-z0-9-]{0,61}[a-z0-9])?`)
+
+	// Matches IPv4 address candidates.
+	ipv4Regexp = regexp.MustCompile(`(?:[0-9]{1,3}\.){3}[0-9]{1,3}`)
+
+	// Matches IPv6 address candidates.
+	ipv6Regexp = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}`)
+)
+
+// Extractor extracts unique hostnames and IP addresses from text.
+// Hostnames are validated against the public suffix list, so things
+// like "index.html" or "file.txt" are skipped.
+// Extractor is not safe for concurrent use.
+type Extractor struct {
+	// Domains limits extracted hostnames to the given base domains and
+	// their subdomains. Empty means no limit. Domains may be under TLDs
+	// unknown to the public suffix list, e.g. "corp.internal".
+	Domains []string
+
+	// Parents enables extraction of parent domains of every found hostname
+	// down to the base domain (see Subdomains) or to the registered
+	// domain if Domains is empty.
+	Parents bool
+
+	// IPs enables extraction of IP addresses.
+	IPs bool
+
+	seen map[string]struct{}
+}
+
+// NewExtractor returns new extractor limited to the given base domains.
+func NewExtractor(domains ...string) *Extractor {
+	return &Extractor{
+		Domains: domains,
+		seen:    make(map[string]struct{}),
+	}
+}
+
+// Extract returns hostnames and IP addresses from the text,
+// which were not seen by the extractor before.
+func (e *Extractor) Extract(text string) []string {
+	if e.seen == nil {
+		e.seen = make(map[string]struct{})
+	}
+
+	res := make([]string, 0)
+
+	add := func(s string) {
+		if _, ok := e.seen[s]; ok {
+			return
+		}
+		e.seen[s] = struct{}{}
+		res = append(res, s)
+	}
+
+	for _, s := range hostnameRegexp.FindAllString(text, -1) {
+		host := strings.ToLower(s)
+
+		base, ok := e.base(host)
+		if !ok {
+			continue
+		}
+
+		add(host)
+
+		if e.Parents {
+			for _, d := range Subdomains(host, base) {
+				add(d)
+			}
+			add(base)
+		}
+	}
+
+	if !e.IPs {
+		return res
+	}
+
+	for _, s := range ipv4Regexp.FindAllString(text, -1) {
+		if ip := net.ParseIP(s); ip != nil {
+			add(ip.String())
+		}
+	}
+
+	for _, s := range ipv6Regexp.FindAllString(text, -1) {
+		if ip := net.ParseIP(s); ip != nil && ip.To4() == nil && !ip.IsUnspecified() {
+			add(ip.String())
+		}
+	}
+
+	return res
+}
+
+// Reader extracts hostnames and IP addresses from every line of r
+// and calls fn for every new one.
+func (e *Extractor) Reader(r io.Reader, fn func(string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), maxLineSize)
+
+	for scanner.Scan() {
+		for _, s := range e.Extract(scanner.Text()) {
+			fn(s)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Iterator extracts hostnames and IP addresses from every item of it
+// and calls fn for every new one.
+func (e *Extractor) Iterator(it iter.Iterator, fn func(string)) {
+	var line string
+
+	for it.Next(&line) {
+		for _, s := range e.Extract(line) {
+			fn(s)
+		}
+	}
+}
+
+// base validates hostname and returns its base domain.
+// Hostnames of the configured domains are not checked against
+// the public suffix list, so internal TLDs can be used.
+func (e *Extractor) base(host string) (string, bool) {
+	if len(host) > 253 {
+		return "", false
+	}
+
+	if len(e.Domains) > 0 {
+		for _, d := range e.Domains {
+			d = strings.ToLower(strings.Trim(d, "."))
+
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return d, true
+			}
+		}
+
+		return "", false
+	}
+
+	suffix, icann := publicsuffix.PublicSuffix(host)
+
+	// Unknown TLD, e.g. "file.txt".
+	if !icann && !strings.Contains(suffix, ".") {
+		return "", false
+	}
+
+	registered, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", false
+	}
+
+	return registered, true
+}
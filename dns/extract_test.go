@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/iter"
+)
+
+func TestExtractor_Extract(t *testing.T) {
+	tests := []struct {
+		name string
+		e    *Extractor
+		text string
+		res  []string
+	}{
+		{
+			"hostnames",
+			NewExtractor(),
+			`GET https://WWW.Example.com/index.html from mail.example.co.uk, see file.txt`,
+			[]string{"www.example.com", "mail.example.co.uk"},
+		},
+		{
+			"domains",
+			NewExtractor("example.com"),
+			`a.example.com b.example.org example.com notexample.com`,
+			[]string{"a.example.com", "example.com"},
+		},
+		{
+			"internal domains",
+			NewExtractor("corp.internal"),
+			`host a.corp.internal and b.example.com, see file.txt`,
+			[]string{"a.corp.internal"},
+		},
+		{
+			"parents",
+			&Extractor{Domains: []string{"example.com"}, Parents: true},
+			`a.b.c.example.com`,
+			[]string{"a.b.c.example.com", "b.c.example.com", "c.example.com", "example.com"},
+		},
+		{
+			"ips",
+			&Extractor{IPs: true},
+			`connect to 10.0.0.1:8080 and [2001:db8::1]:53 at 12:30:45, not 999.1.1.1`,
+			[]string{"10.0.0.1", "2001:db8::1"},
+		},
+		{
+			"no ips",
+			NewExtractor(),
+			`10.0.0.1 example.com`,
+			[]string{"example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.res, tt.e.Extract(tt.text))
+		})
+	}
+}
+
+func TestExtractor_Dedup(t *testing.T) {
+	e := &Extractor{IPs: true}
+
+	res := make([]string, 0)
+	add := func(s string) { res = append(res, s) }
+
+	text := "example.com 1.1.1.1\nEXAMPLE.com a.example.com\n1.1.1.1"
+	require.NoError(t, e.Reader(strings.NewReader(text), add))
+
+	e.Iterator(iter.Slice([]string{"a.example.com", "b.example.com"}), add)
+
+	assert.Equal(t, []string{"example.com", "1.1.1.1", "a.example.com", "b.example.com"}, res)
+}
@@ -0,0 +1,426 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/russtone/utils/output"
+)
+
+// Change types.
+const (
+	ChangeNew     = "new"
+	ChangeGone    = "gone"
+	ChangeChanged = "changed"
+)
+
+// History is a local store of resolution results.
+// It is an append-only file of JSON lines, every line is either
+// a run header or a single result recorded in the run.
+type History struct {
+	mu sync.Mutex
+
+	path string
+	file *os.File
+
+	runs    []RunInfo
+	entries map[string]*Entry
+}
+
+// RunInfo represents recorded run.
+type RunInfo struct {
+	ID   int
+	Time time.Time
+}
+
+// Entry represents history of a name.
+type Entry struct {
+	Name string
+
+	// FirstSeen is time of the first run the name was seen in.
+	FirstSeen time.Time
+
+	// LastSeen is time of the last run the name was seen in.
+	LastSeen time.Time
+
+	// ChangedAt is time of the last run the name answers were changed in.
+	ChangedAt time.Time
+
+	// Answers are the last seen answers.
+	Answers map[string][]string
+}
+
+// Change represents difference of a name between two runs.
+type Change struct {
+	Type string
+	Name string
+	Old  map[string][]string `json:",omitempty"`
+	New  map[string][]string `json:",omitempty"`
+}
+
+// historyRecord is a line of history file.
+// Record without name is a run header.
+type historyRecord struct {
+	Run     int                 `json:"run"`
+	Time    time.Time           `json:"time"`
+	Name    string              `json:"name,omitempty"`
+	Answers map[string][]string `json:"answers,omitempty"`
+	Errors  map[string]string   `json:"errors,omitempty"`
+}
+
+// OpenHistory opens history file, the file is created if it does not exist.
+func OpenHistory(path string) (*History, error) {
+	h := &History{
+		path:    path,
+		runs:    make([]RunInfo, 0),
+		entries: make(map[string]*Entry),
+	}
+
+	size, err := h.scan(func(rec historyRecord) {
+		if rec.Name == "" {
+			h.runs = append(h.runs, RunInfo{ID: rec.Run, Time: rec.Time})
+			return
+		}
+
+		h.update(rec)
+	})
+
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		// Drop incomplete last line, so new records are not appended to it.
+		if err := os.Truncate(path, size); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	h.file = file
+
+	return h, nil
+}
+
+// Close closes history file.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.file.Close()
+}
+
+// Runs returns all recorded runs from the oldest to the newest.
+func (h *History) Runs() []RunInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs := make([]RunInfo, len(h.runs))
+	copy(runs, h.runs)
+
+	return runs
+}
+
+// Lookup returns history of the name.
+func (h *History) Lookup(name string) (Entry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.entries[name]
+	if !ok {
+		return Entry{}, false
+	}
+
+	return *e, true
+}
+
+// ChangedSince returns history of names which were changed
+// or seen for the first time since t.
+func (h *History) ChangedSince(t time.Time) []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	res := make([]Entry, 0)
+
+	for _, e := range h.entries {
+		if !e.ChangedAt.Before(t) {
+			res = append(res, *e)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+// Begin starts a new run.
+func (h *History) Begin() (*Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	info := RunInfo{ID: 1, Time: time.Now()}
+
+	if len(h.runs) > 0 {
+		info.ID = h.runs[len(h.runs)-1].ID + 1
+	}
+
+	if err := h.write(historyRecord{Run: info.ID, Time: info.Time}); err != nil {
+		return nil, err
+	}
+
+	h.runs = append(h.runs, info)
+
+	return &Run{RunInfo: info, history: h}, nil
+}
+
+// Diff writes changes between two runs into w.
+// Names which were not resolved in a run are treated as gone,
+// but names whose queries failed are not.
+func (h *History) Diff(from, to int, w output.Writer) error {
+	old := make(map[string]map[string][]string)
+	cur := make(map[string]map[string][]string)
+
+	h.mu.Lock()
+	_, err := h.scan(func(rec historyRecord) {
+		switch {
+		case rec.Name == "":
+			return
+		case rec.Run == from:
+			old[rec.Name] = rec.Answers
+		case rec.Run == to:
+			cur[rec.Name] = rec.Answers
+		}
+	})
+	h.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	changes := make([]Change, 0)
+
+	for name, answers := range cur {
+		prev, ok := old[name]
+
+		switch {
+		case !ok && emptyAnswers(answers):
+			// Failed lookup of a new name tells nothing about it.
+		case !ok:
+			changes = append(changes, Change{Type: ChangeNew, Name: name, New: answers})
+		case !equalAnswers(prev, answers):
+			changes = append(changes, Change{Type: ChangeChanged, Name: name, Old: prev, New: answers})
+		}
+	}
+
+	for name, answers := range old {
+		if _, ok := cur[name]; !ok && !emptyAnswers(answers) {
+			changes = append(changes, Change{Type: ChangeGone, Name: name, Old: answers})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	for _, c := range changes {
+		if err := w.Write(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DiffLast writes changes between the last two runs into w.
+func (h *History) DiffLast(w output.Writer) error {
+	runs := h.Runs()
+
+	if len(runs) < 2 {
+		return nil
+	}
+
+	return h.Diff(runs[len(runs)-2].ID, runs[len(runs)-1].ID, w)
+}
+
+// scan calls fn for every record of the history file and returns size
+// of the complete records. Incomplete last line, which is left by
+// interrupted write, is skipped.
+func (h *History) scan(fn func(historyRecord)) (int64, error) {
+	file, err := os.Open(h.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var size int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+
+		if err != nil {
+			return size, err
+		}
+
+		var rec historyRecord
+
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return size, err
+		}
+
+		fn(rec)
+
+		size += int64(len(line))
+	}
+}
+
+func (h *History) write(rec historyRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.file.Write(append(b, '\n'))
+
+	return err
+}
+
+func (h *History) update(rec historyRecord) {
+	e, ok := h.entries[rec.Name]
+	seen := !emptyAnswers(rec.Answers)
+
+	if !ok {
+		if !seen {
+			return
+		}
+
+		h.entries[rec.Name] = &Entry{
+			Name:      rec.Name,
+			FirstSeen: rec.Time,
+			LastSeen:  rec.Time,
+			ChangedAt: rec.Time,
+			Answers:   rec.Answers,
+		}
+		return
+	}
+
+	answers := rec.Answers
+
+	// Answers of failed queries are unknown, so the last seen ones are kept.
+	if len(rec.Errors) > 0 {
+		answers = make(map[string][]string, len(e.Answers))
+
+		for qtype, values := range e.Answers {
+			if _, failed := rec.Errors[qtype]; failed {
+				answers[qtype] = values
+			}
+		}
+
+		for qtype, values := range rec.Answers {
+			answers[qtype] = values
+		}
+	}
+
+	if !equalAnswers(e.Answers, answers) {
+		e.ChangedAt = rec.Time
+	}
+
+	if seen {
+		e.LastSeen = rec.Time
+	}
+
+	e.Answers = answers
+}
+
+// Run represents a single run of resolution.
+type Run struct {
+	RunInfo
+
+	history *History
+}
+
+// Add records result in the run. Results without answers are skipped,
+// so the name is treated as gone in the run, unless some of its
+// queries failed, see Result.Failed.
+func (r *Run) Add(res Result) error {
+	if res.IsEmpty() && !res.Failed() {
+		return nil
+	}
+
+	answers := make(map[string][]string, len(res.Answers))
+
+	for qtype, values := range res.Answers {
+		sorted := make([]string, len(values))
+		copy(sorted, values)
+		sort.Strings(sorted)
+		answers[qtype] = sorted
+	}
+
+	rec := historyRecord{
+		Run:     r.ID,
+		Time:    r.Time,
+		Name:    res.Name,
+		Answers: answers,
+		Errors:  res.Errors,
+	}
+
+	r.history.mu.Lock()
+	defer r.history.mu.Unlock()
+
+	if err := r.history.write(rec); err != nil {
+		return err
+	}
+
+	r.history.update(rec)
+
+	return nil
+}
+
+// emptyAnswers returns true if there are no answers of any query type.
+func emptyAnswers(answers map[string][]string) bool {
+	for _, values := range answers {
+		if len(values) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalAnswers compares answers of query types present in both a and b.
+// Query types present only in one of them (e.g. failed queries) are ignored.
+func equalAnswers(a, b map[string][]string) bool {
+	for qtype, av := range a {
+		bv, ok := b[qtype]
+		if !ok {
+			continue
+		}
+
+		if len(av) != len(bv) {
+			return false
+		}
+
+		for i := range av {
+			if av[i] != bv[i] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
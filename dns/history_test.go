@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type changesWriter []Change
+
+func (w *changesWriter) Write(v interface{}) error {
+	*w = append(*w, v.(Change))
+	return nil
+}
+
+func result(name string, ips ...string) Result {
+	return Result{Name: name, Answers: map[string][]string{TypeA: ips}}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := OpenHistory(path)
+	require.NoError(t, err)
+
+	run1, err := h.Begin()
+	require.NoError(t, err)
+
+	require.NoError(t, run1.Add(result("a.example.com", "1.1.1.1", "2.2.2.2")))
+	require.NoError(t, run1.Add(result("b.example.com", "3.3.3.3")))
+	require.NoError(t, run1.Add(result("c.example.com", "4.4.4.4")))
+
+	time.Sleep(10 * time.Millisecond)
+
+	run2, err := h.Begin()
+	require.NoError(t, err)
+
+	require.NoError(t, run2.Add(result("a.example.com", "2.2.2.2", "1.1.1.1")))
+	require.NoError(t, run2.Add(result("b.example.com", "5.5.5.5")))
+	require.NoError(t, run2.Add(result("d.example.com", "6.6.6.6")))
+	require.NoError(t, run2.Add(result("e.example.com")))
+
+	require.NoError(t, h.Close())
+
+	// Reopen to check that everything is restored from the file.
+	h, err = OpenHistory(path)
+	require.NoError(t, err)
+	defer h.Close()
+
+	runs := h.Runs()
+	require.Len(t, runs, 2)
+	assert.Equal(t, 2, runs[1].ID)
+
+	a, ok := h.Lookup("a.example.com")
+	require.True(t, ok)
+	assert.True(t, a.FirstSeen.Equal(runs[0].Time))
+	assert.True(t, a.LastSeen.Equal(runs[1].Time))
+	assert.True(t, a.ChangedAt.Equal(runs[0].Time))
+
+	_, ok = h.Lookup("e.example.com")
+	assert.False(t, ok)
+
+	changed := h.ChangedSince(runs[1].Time)
+	require.Len(t, changed, 2)
+	assert.Equal(t, "b.example.com", changed[0].Name)
+	assert.Equal(t, "d.example.com", changed[1].Name)
+
+	var w changesWriter
+	require.NoError(t, h.DiffLast(&w))
+
+	assert.Equal(t, changesWriter{
+		{
+			Type: ChangeChanged,
+			Name: "b.example.com",
+			Old:  map[string][]string{TypeA: {"3.3.3.3"}},
+			New:  map[string][]string{TypeA: {"5.5.5.5"}},
+		},
+		{
+			Type: ChangeGone,
+			Name: "c.example.com",
+			Old:  map[string][]string{TypeA: {"4.4.4.4"}},
+		},
+		{
+			Type: ChangeNew,
+			Name: "d.example.com",
+			New:  map[string][]string{TypeA: {"6.6.6.6"}},
+		},
+	}, w)
+}
+
+func TestHistory_TornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := OpenHistory(path)
+	require.NoError(t, err)
+
+	run, err := h.Begin()
+	require.NoError(t, err)
+	require.NoError(t, run.Add(result("a.example.com", "1.1.1.1")))
+	require.NoError(t, h.Close())
+
+	// Interrupted write leaves half of a line.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"run":1,"time":"2020-01-01T00:00:00Z","name":"b.exa`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	h, err = OpenHistory(path)
+	require.NoError(t, err)
+
+	_, ok := h.Lookup("a.example.com")
+	assert.True(t, ok)
+
+	_, ok = h.Lookup("b.example.com")
+	assert.False(t, ok)
+
+	run, err = h.Begin()
+	require.NoError(t, err)
+	require.NoError(t, run.Add(result("c.example.com", "3.3.3.3")))
+	require.NoError(t, h.Close())
+
+	// New records are not glued to the torn one.
+	h, err = OpenHistory(path)
+	require.NoError(t, err)
+	defer h.Close()
+
+	assert.Len(t, h.Runs(), 2)
+
+	_, ok = h.Lookup("c.example.com")
+	assert.True(t, ok)
+}
+
+func TestHistory_Failed(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history"))
+	require.NoError(t, err)
+	defer h.Close()
+
+	run1, err := h.Begin()
+	require.NoError(t, err)
+
+	require.NoError(t, run1.Add(result("a.example.com", "1.1.1.1")))
+	require.NoError(t, run1.Add(result("b.example.com", "2.2.2.2")))
+
+	time.Sleep(10 * time.Millisecond)
+
+	run2, err := h.Begin()
+	require.NoError(t, err)
+
+	// Lookup of a timed out, b is not resolved anymore,
+	// c is failed and was never seen.
+	timeout := map[string]string{TypeA: "i/o timeout"}
+	require.NoError(t, run2.Add(Result{Name: "a.example.com", Errors: timeout}))
+	require.NoError(t, run2.Add(Result{Name: "c.example.com", Errors: timeout}))
+
+	var w changesWriter
+	require.NoError(t, h.DiffLast(&w))
+
+	assert.Equal(t, changesWriter{
+		{
+			Type: ChangeGone,
+			Name: "b.example.com",
+			Old:  map[string][]string{TypeA: {"2.2.2.2"}},
+		},
+	}, w)
+
+	a, ok := h.Lookup("a.example.com")
+	require.True(t, ok)
+	assert.Equal(t, map[string][]string{TypeA: {"1.1.1.1"}}, a.Answers)
+	assert.True(t, a.LastSeen.Equal(run1.Time))
+
+	_, ok = h.Lookup("c.example.com")
+	assert.False(t, ok)
+}
@@ -23,21 +23,21 @@ func newServer(ip net.IP, rateLimit float64) server {
 	}
 }
 
-func (s *server) query(name string, qtype string) ([]string, error) {
+func (s *server) query(name string, qtype string) ([]string, int, error) {
 
 	defer func() {
 		s.lastUsedAt = time.Now()
 	}()
 
-	res, err := Query(name, s.ip, qtype)
+	in, _, err := Exchange(name, s.ip, qtype)
 
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	s.queriesCount++
 
-	return res, err
+	return answers(in.Answer, qtype), in.Rcode, nil
 }
 
 func (s *server) rate() float64 {
@@ -68,6 +68,28 @@ func (p *pool) take() server {
 	return <-p.servers
 }
 
+// takeExcept returns server other than the server with the given IP
+// if another server is available right away. It does not wait for
+// another server while holding the taken one, so workers never block
+// each other.
+func (p *pool) takeExcept(ip net.IP) server {
+	s := p.take()
+
+	if ip == nil || !s.ip.Equal(ip) {
+		return s
+	}
+
+	select {
+	case other := <-p.servers:
+		// There is always room for the server in the channel,
+		// because two servers were just taken from it.
+		p.servers <- s
+		return other
+	default:
+		return s
+	}
+}
+
 func (p *pool) release(s server) {
 	go func() {
 		if delay := s.delay(); delay > 0 {
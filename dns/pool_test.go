@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool_TakeExcept(t *testing.T) {
+	servers := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+
+	p := &pool{
+		servers:   make(chan server, len(servers)),
+		rateLimit: 1000,
+	}
+
+	for _, ip := range servers {
+		p.add(ip)
+	}
+
+	// More workers than servers, every one avoids the server
+	// it used last time.
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(last net.IP) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				s := p.takeExcept(last)
+				last = s.ip
+				p.release(s)
+			}
+		}(servers[i%2])
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers are deadlocked")
+	}
+}
+
+func TestPool_TakeExceptRotates(t *testing.T) {
+	servers := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+
+	p := &pool{
+		servers:   make(chan server, len(servers)),
+		rateLimit: 1000,
+	}
+
+	for _, ip := range servers {
+		p.add(ip)
+	}
+
+	s := p.takeExcept(servers[0])
+	assert.True(t, s.ip.Equal(servers[1]))
+
+	// The only available server is returned, even if it is excluded.
+	s = p.takeExcept(servers[0])
+	assert.True(t, s.ip.Equal(servers[0]))
+}
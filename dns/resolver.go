@@ -2,6 +2,8 @@ package dns
 
 import (
 	"net"
+	"sync"
+	"time"
 
 	"github.com/russtone/utils/jobqueue"
 )
@@ -9,7 +11,12 @@ import (
 type Resolver struct {
 	jobqueue.Queue
 
-	pool *pool
+	// queue is the same queue with runtime control and statistics.
+	queue jobqueue.ControlledQueue
+
+	pool  *pool
+	stats *statsCollector
+	retry Retry
 }
 
 func NewResolver(servers []net.IP, workersCount int, rateLimit float64, capacity int) *Resolver {
@@ -24,10 +31,13 @@ func NewResolver(servers []net.IP, workersCount int, rateLimit float64, capacity
 	}
 
 	r := &Resolver{
-		pool: pool,
+		pool:  pool,
+		stats: newStatsCollector(),
+		retry: DefaultRetry,
 	}
 
-	r.Queue = jobqueue.New(r, workersCount, capacity)
+	r.queue = jobqueue.New(r, workersCount, capacity)
+	r.Queue = r.queue
 
 	return r
 }
@@ -38,7 +48,13 @@ func (r *Resolver) Process(j interface{}) (interface{}, bool, error) {
 		return nil, false, jobqueue.ErrInvalidJob
 	}
 
-	ns := r.pool.take()
+	var ns server
+
+	if r.retry.Rotate {
+		ns = r.pool.takeExcept(job.lastServer)
+	} else {
+		ns = r.pool.take()
+	}
 
 	defer func() {
 		r.pool.release(ns)
@@ -46,32 +62,117 @@ func (r *Resolver) Process(j interface{}) (interface{}, bool, error) {
 
 	qtype := job.qtype()
 
-	answer, err := ns.query(job.Name, qtype)
+	start := time.Now()
+
+	answer, rcode, err := ns.query(job.Name, qtype)
+
+	r.stats.observe(ns.ip, qtype, time.Since(start), rcode, err)
 
 	if err != nil {
-		return nil, true, err
+		job.attempts++
+
+		if !r.retry.exhausted(job.attempts) {
+			// Only retries of failed attempts are rotated.
+			job.lastServer = ns.ip
+
+			// Backoff is done by the queue, so the worker is not held.
+			r.stats.retry()
+			return nil, true, jobqueue.RetryAfter(err, r.retry.delay(job.attempts))
+		}
+
+		// Out of attempts: give up on this query type and
+		// report the failure reason in the result.
+		job.setError(qtype, err)
+	} else {
+		job.setAnswer(qtype, answer)
 	}
 
-	job.setAnswer(qtype, answer)
+	job.lastServer = nil
 
 	res := Result{
 		Name:    job.Name,
 		Answers: job.Answers,
+		Errors:  job.Errors,
 		Meta:    job.Meta,
 	}
 
 	return res, !job.done(), nil
 }
 
+// SetRetry sets retry policy for failed queries.
+// Must be called before the resolver is started.
+func (r *Resolver) SetRetry(retry Retry) {
+	r.retry = retry
+}
+
 func (r *Resolver) Schedule(name string, qtypes []string, meta map[string]interface{}) {
 	r.Queue.Schedule(&Job{
 		Name:    name,
 		Qtypes:  qtypes,
 		Answers: make(map[string][]string),
+		Errors:  make(map[string]string),
 		Meta:    meta,
 	})
 }
 
+// ScheduleFunc returns function which schedules resolution of the given
+// hostname with the given query types or, in case of IP address, PTR query.
+// The returned function is meant to be used as Extractor callback:
+//
+//	e.Reader(f, r.ScheduleFunc([]string{dns.TypeA}))
+//
+// Every call increments jobs count, so there is no need to call Add.
+func (r *Resolver) ScheduleFunc(qtypes []string) func(string) {
+	return func(s string) {
+		r.Add(1)
+
+		if ip := net.ParseIP(s); ip != nil {
+			r.Schedule(PTR(ip), []string{TypePTR}, map[string]interface{}{"ip": s})
+			return
+		}
+
+		r.Schedule(s, qtypes, nil)
+	}
+}
+
+// Stats returns snapshot of the resolver statistics.
+func (r *Resolver) Stats() Stats {
+	s := r.stats.snapshot()
+	qs := r.queue.Stats()
+	s.Progress = qs.Progress()
+	s.Speed = qs.Rate
+	s.ETA = qs.ETA
+	return s
+}
+
+// ReportStats calls fn with snapshot of the resolver statistics
+// every interval until the returned stop function is called.
+func (r *Resolver) ReportStats(interval time.Duration, fn func(Stats)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn(r.Stats())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
 //
 // Job
 //
@@ -80,13 +181,16 @@ type Job struct {
 	Name    string
 	Qtypes  []string
 	Answers map[string][]string
+	Errors  map[string]string
 	Meta    map[string]interface{}
 
-	qtypeIdx int
+	qtypeIdx   int
+	attempts   int
+	lastServer net.IP
 }
 
 func (j *Job) done() bool {
-	return len(j.Answers) == len(j.Qtypes)
+	return j.qtypeIdx >= len(j.Qtypes)
 }
 
 func (j *Job) qtype() string {
@@ -99,7 +203,21 @@ func (j *Job) qtype() string {
 
 func (j *Job) setAnswer(qtype string, answer []string) {
 	j.Answers[qtype] = answer
+	j.next()
+}
+
+func (j *Job) setError(qtype string, err error) {
+	if j.Errors == nil {
+		j.Errors = make(map[string]string)
+	}
+
+	j.Errors[qtype] = err.Error()
+	j.next()
+}
+
+func (j *Job) next() {
 	j.qtypeIdx++
+	j.attempts = 0
 }
 
 //
@@ -109,7 +227,17 @@ func (j *Job) setAnswer(qtype string, answer []string) {
 type Result struct {
 	Name    string
 	Answers map[string][]string
-	Meta    map[string]interface{}
+
+	// Errors contains failure reasons by query type
+	// for queries which ran out of attempts.
+	Errors map[string]string
+
+	Meta map[string]interface{}
+}
+
+// Failed returns true if at least one of the queries failed.
+func (r *Result) Failed() bool {
+	return len(r.Errors) > 0
 }
 
 func (r *Result) IsEmpty() bool {
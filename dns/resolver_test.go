@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// goodServer answers all A queries, nothing listens on badServer,
+	// so its queries are refused right away.
+	goodServer = net.ParseIP("127.0.0.1")
+	badServer  = net.ParseIP("127.0.0.2")
+)
+
+// startServer starts DNS server on goodServer and sets port to its port.
+func startServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(goodServer.String(), "0"))
+	require.NoError(t, err)
+
+	srv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(req)
+
+			q := req.Question[0]
+			if q.Qtype == dns.TypeA {
+				rr, _ := dns.NewRR(q.Name + " 60 IN A 10.0.0.1")
+				m.Answer = append(m.Answer, rr)
+			}
+
+			w.WriteMsg(m)
+		}),
+	}
+
+	go srv.ActivateAndServe()
+
+	prev := port
+	port = pc.LocalAddr().(*net.UDPAddr).Port
+
+	t.Cleanup(func() {
+		srv.Shutdown()
+		port = prev
+	})
+}
+
+// resolve runs resolver until all the jobs are done and returns results.
+func resolve(t *testing.T, r *Resolver, names []string, qtypes []string) []Result {
+	r.Start()
+
+	r.Add(len(names))
+	for _, name := range names {
+		r.Schedule(name, qtypes, nil)
+	}
+
+	r.Stop()
+
+	done := make(chan []Result)
+
+	go func() {
+		res := make([]Result, 0)
+
+		var v Result
+		for r.Next(&v) {
+			res = append(res, v)
+		}
+
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		r.WaitJobs()
+		return res
+	case <-time.After(10 * time.Second):
+		t.Fatal("resolver is not finished")
+		return nil
+	}
+}
+
+func TestResolver_Exhausted(t *testing.T) {
+	startServer(t)
+
+	r := NewResolver([]net.IP{badServer}, 2, 100, 10)
+	r.SetRetry(Retry{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	res := resolve(t, r, []string{"a.example.com"}, []string{TypeA})
+
+	require.Len(t, res, 1)
+	assert.True(t, res[0].Failed())
+	assert.NotEmpty(t, res[0].Errors[TypeA])
+	assert.True(t, res[0].IsEmpty())
+
+	s := r.Stats()
+	assert.Equal(t, uint64(2), s.Retries)
+	assert.Equal(t, uint64(3), s.Servers[badServer.String()].Errors)
+}
+
+func TestResolver_Rotate(t *testing.T) {
+	const jobs = 10
+
+	startServer(t)
+
+	// Servers are taken in order, so without rotation the retry
+	// of a query failed on the first badServer goes to the second one.
+	r := NewResolver([]net.IP{badServer, badServer, goodServer}, 1, 100, 2*jobs)
+	r.SetRetry(Retry{MaxAttempts: 2, Rotate: true, Backoff: 20 * time.Millisecond})
+
+	r.Start()
+	defer r.Stop()
+
+	// Jobs are resolved one by one after all the servers are released,
+	// so servers are always taken in the same order.
+	for i := 0; i < jobs; i++ {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(r.pool.servers) < 3 {
+			if time.Now().After(deadline) {
+				t.Fatal("servers are not released")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		r.Add(1)
+		r.Schedule("a.example.com", []string{TypeA}, nil)
+
+		var res Result
+		require.True(t, r.Next(&res))
+
+		assert.False(t, res.Failed(), res.Errors)
+		assert.Equal(t, []string{"10.0.0.1"}, res.Answers[TypeA])
+	}
+
+	s := r.Stats()
+	assert.Equal(t, uint64(jobs), s.Retries)
+	assert.Equal(t, uint64(jobs), s.Servers[badServer.String()].Errors)
+	assert.Equal(t, uint64(jobs), s.Servers[goodServer.String()].Queries)
+}
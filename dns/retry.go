@@ -0,0 +1,59 @@
+package dns
+
+import "time"
+
+// DefaultRetry is the retry policy used by new resolvers.
+var DefaultRetry = Retry{
+	MaxAttempts: 3,
+	Rotate:      true,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+// Retry represents resolver policy for failed queries.
+type Retry struct {
+	// MaxAttempts is maximum number of attempts per query type of a job.
+	// Zero means unlimited number of attempts.
+	MaxAttempts int
+
+	// Rotate enables sending every next attempt to a different server
+	// (if there is more than one server).
+	Rotate bool
+
+	// Backoff is delay before the second attempt, every next delay
+	// is doubled. Zero means no delay.
+	Backoff time.Duration
+
+	// MaxBackoff limits delay between attempts. Zero means no limit.
+	MaxBackoff time.Duration
+}
+
+// exhausted returns true if there must be no more attempts
+// after the given number of attempts.
+func (r Retry) exhausted(attempts int) bool {
+	return r.MaxAttempts > 0 && attempts >= r.MaxAttempts
+}
+
+// delay returns delay before the next attempt after
+// the given number of failed attempts.
+func (r Retry) delay(attempts int) time.Duration {
+	if r.Backoff <= 0 || attempts <= 0 {
+		return 0
+	}
+
+	d := r.Backoff
+
+	for i := 1; i < attempts; i++ {
+		d *= 2
+
+		if r.MaxBackoff > 0 && d >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+
+	return d
+}
@@ -0,0 +1,51 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	r := Retry{
+		MaxAttempts: 3,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+
+	assert.False(t, r.exhausted(2))
+	assert.True(t, r.exhausted(3))
+	assert.False(t, Retry{}.exhausted(100))
+
+	assert.Equal(t, time.Duration(0), r.delay(0))
+	assert.Equal(t, 100*time.Millisecond, r.delay(1))
+	assert.Equal(t, 200*time.Millisecond, r.delay(2))
+	assert.Equal(t, 800*time.Millisecond, r.delay(4))
+	assert.Equal(t, time.Second, r.delay(5))
+	assert.Equal(t, time.Second, r.delay(100))
+	assert.Equal(t, time.Duration(0), Retry{}.delay(3))
+}
+
+func TestJob_SetError(t *testing.T) {
+	job := &Job{
+		Name:    "example.com",
+		Qtypes:  []string{TypeA, TypeMX},
+		Answers: make(map[string][]string),
+	}
+
+	job.attempts = 2
+	job.setError(TypeA, timeoutError{})
+
+	assert.False(t, job.done())
+	assert.Equal(t, 0, job.attempts)
+	assert.Equal(t, TypeMX, job.qtype())
+
+	job.setAnswer(TypeMX, []string{"mx.example.com"})
+
+	assert.True(t, job.done())
+
+	res := Result{Answers: job.Answers, Errors: job.Errors}
+	assert.True(t, res.Failed())
+	assert.Equal(t, "timeout", res.Errors[TypeA])
+}
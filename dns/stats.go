@@ -0,0 +1,259 @@
+package dns
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// latencyBounds are upper bounds of latency histogram buckets.
+var latencyBounds = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// Histogram represents queries latency distribution.
+type Histogram struct {
+	// Bounds are upper bounds of the buckets.
+	Bounds []time.Duration
+
+	// Counts are numbers of observations in each bucket.
+	// The last item counts observations greater than the last bound.
+	Counts []uint64
+
+	// Count is total number of observations.
+	Count uint64
+
+	// Sum is sum of all observations.
+	Sum time.Duration
+
+	// Max is the greatest observation.
+	Max time.Duration
+}
+
+func newHistogram() Histogram {
+	return Histogram{
+		Bounds: latencyBounds,
+		Counts: make([]uint64, len(latencyBounds)+1),
+	}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for ; i < len(h.Bounds); i++ {
+		if d <= h.Bounds[i] {
+			break
+		}
+	}
+
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// Mean returns mean latency.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns upper bound of the bucket which contains q-quantile
+// of observations, e.g. Quantile(0.99) for p99 latency.
+// For observations greater than the last bound Max is returned.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(h.Count))
+	if rank >= h.Count {
+		rank = h.Count - 1
+	}
+
+	seen := uint64(0)
+
+	for i, c := range h.Counts {
+		seen += c
+		if seen > rank {
+			if i < len(h.Bounds) {
+				return h.Bounds[i]
+			}
+			break
+		}
+	}
+
+	return h.Max
+}
+
+func (h Histogram) clone() Histogram {
+	counts := make([]uint64, len(h.Counts))
+	copy(counts, h.Counts)
+	h.Counts = counts
+	return h
+}
+
+// QueryStats represents statistics of DNS queries.
+type QueryStats struct {
+	// Queries is total number of sent queries.
+	Queries uint64
+
+	// Timeouts is number of queries failed due to timeout.
+	Timeouts uint64
+
+	// Errors is number of queries failed due to any error
+	// including timeouts.
+	Errors uint64
+
+	// Rcodes is number of responses by response code, e.g. "NOERROR", "NXDOMAIN".
+	Rcodes map[string]uint64
+
+	// Latency is latency distribution of all queries.
+	Latency Histogram
+}
+
+func newQueryStats() *QueryStats {
+	return &QueryStats{
+		Rcodes:  make(map[string]uint64),
+		Latency: newHistogram(),
+	}
+}
+
+func (s *QueryStats) observe(d time.Duration, rcode int, err error) {
+	s.Queries++
+	s.Latency.observe(d)
+
+	if err != nil {
+		s.Errors++
+
+		if isTimeout(err) {
+			s.Timeouts++
+		}
+
+		return
+	}
+
+	s.Rcodes[dns.RcodeToString[rcode]]++
+}
+
+func (s *QueryStats) clone() QueryStats {
+	c := *s
+	c.Rcodes = make(map[string]uint64, len(s.Rcodes))
+	for k, v := range s.Rcodes {
+		c.Rcodes[k] = v
+	}
+	c.Latency = s.Latency.clone()
+	return c
+}
+
+// Stats represents snapshot of Resolver statistics.
+type Stats struct {
+	// QueryStats is statistics of all queries.
+	QueryStats
+
+	// Retries is number of retried queries.
+	Retries uint64
+
+	// Servers is statistics of queries by DNS server IP.
+	Servers map[string]QueryStats
+
+	// Qtypes is statistics of queries by query type.
+	Qtypes map[string]QueryStats
+
+	// Progress is resolver jobs progress, see jobqueue.Queue.
+	Progress float64
+
+	// Speed is resolver jobs speed, see jobqueue.Queue.
+	Speed float64
+
+	// ETA is estimated time until all the jobs are resolved.
+	ETA time.Duration
+}
+
+// statsCollector collects resolver statistics.
+type statsCollector struct {
+	mu sync.Mutex
+
+	total   *QueryStats
+	retries uint64
+	servers map[string]*QueryStats
+	qtypes  map[string]*QueryStats
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		total:   newQueryStats(),
+		servers: make(map[string]*QueryStats),
+		qtypes:  make(map[string]*QueryStats),
+	}
+}
+
+func (c *statsCollector) observe(ns net.IP, qtype string, d time.Duration, rcode int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total.observe(d, rcode, err)
+
+	key := ns.String()
+
+	if _, ok := c.servers[key]; !ok {
+		c.servers[key] = newQueryStats()
+	}
+	c.servers[key].observe(d, rcode, err)
+
+	if _, ok := c.qtypes[qtype]; !ok {
+		c.qtypes[qtype] = newQueryStats()
+	}
+	c.qtypes[qtype].observe(d, rcode, err)
+}
+
+func (c *statsCollector) retry() {
+	c.mu.Lock()
+	c.retries++
+	c.mu.Unlock()
+}
+
+func (c *statsCollector) snapshot() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Stats{
+		QueryStats: c.total.clone(),
+		Retries:    c.retries,
+		Servers:    make(map[string]QueryStats, len(c.servers)),
+		Qtypes:     make(map[string]QueryStats, len(c.qtypes)),
+	}
+
+	for k, v := range c.servers {
+		s.Servers[k] = v.clone()
+	}
+
+	for k, v := range c.qtypes {
+		s.Qtypes[k] = v.clone()
+	}
+
+	return s
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
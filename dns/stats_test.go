@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram()
+
+	for _, d := range []time.Duration{
+		500 * time.Microsecond,
+		3 * time.Millisecond,
+		3 * time.Millisecond,
+		40 * time.Millisecond,
+		10 * time.Second,
+	} {
+		h.observe(d)
+	}
+
+	assert.Equal(t, uint64(5), h.Count)
+	assert.Equal(t, 10*time.Second, h.Max)
+	assert.Equal(t, uint64(1), h.Counts[0])
+	assert.Equal(t, uint64(2), h.Counts[2])
+	assert.Equal(t, uint64(1), h.Counts[len(h.Counts)-1])
+	assert.Equal(t, 5*time.Millisecond, h.Quantile(0.5))
+	assert.Equal(t, 10*time.Second, h.Quantile(0.99))
+	assert.Equal(t, time.Duration(0), newHistogram().Quantile(0.5))
+}
+
+func TestStatsCollector(t *testing.T) {
+	c := newStatsCollector()
+
+	ns1 := net.ParseIP("1.1.1.1")
+	ns2 := net.ParseIP("8.8.8.8")
+
+	c.observe(ns1, TypeA, time.Millisecond, dns.RcodeSuccess, nil)
+	c.observe(ns1, TypeA, time.Millisecond, dns.RcodeNameError, nil)
+	c.observe(ns2, TypeMX, time.Second, 0, timeoutError{})
+	c.observe(ns2, TypeMX, time.Second, 0, errors.New("refused"))
+	c.retry()
+
+	s := c.snapshot()
+
+	assert.Equal(t, uint64(4), s.Queries)
+	assert.Equal(t, uint64(2), s.Errors)
+	assert.Equal(t, uint64(1), s.Timeouts)
+	assert.Equal(t, uint64(1), s.Retries)
+	assert.Equal(t, map[string]uint64{"NOERROR": 1, "NXDOMAIN": 1}, s.Rcodes)
+
+	assert.Equal(t, uint64(2), s.Servers["1.1.1.1"].Queries)
+	assert.Equal(t, uint64(0), s.Servers["1.1.1.1"].Errors)
+	assert.Equal(t, uint64(1), s.Servers["8.8.8.8"].Timeouts)
+	assert.Equal(t, uint64(2), s.Qtypes[TypeMX].Errors)
+
+	// Snapshot must not change after new observations.
+	c.observe(ns1, TypeA, time.Millisecond, dns.RcodeSuccess, nil)
+	assert.Equal(t, uint64(1), s.Rcodes["NOERROR"])
+	assert.Equal(t, uint64(2), s.Servers["1.1.1.1"].Latency.Count)
+}
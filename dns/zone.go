@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/russtone/utils/output"
+)
+
+// Record represents DNS resource record.
+type Record struct {
+	Name  string
+	TTL   uint32
+	Type  string
+	Value string
+}
+
+// String returns record in master file format.
+func (r Record) String() string {
+	return fmt.Sprintf("%s.\t%d\tIN\t%s\t%s", r.Name, r.TTL, r.Type, r.Value)
+}
+
+func newRecord(rr dns.RR) Record {
+	hdr := rr.Header()
+
+	return Record{
+		Name:  strings.TrimSuffix(strings.ToLower(hdr.Name), "."),
+		TTL:   hdr.Ttl,
+		Type:  dns.TypeToString[hdr.Rrtype],
+		Value: strings.TrimPrefix(rr.String(), hdr.String()),
+	}
+}
+
+// ZoneReader reads records from RFC 1035 master file.
+type ZoneReader struct {
+	zp *dns.ZoneParser
+}
+
+// NewZoneReader returns new master file reader. Origin is used
+// for relative names, it may be empty if all names are absolute.
+func NewZoneReader(r io.Reader, origin string) *ZoneReader {
+	if origin != "" {
+		origin = dns.Fqdn(origin)
+	}
+
+	return &ZoneReader{
+		zp: dns.NewZoneParser(r, origin, ""),
+	}
+}
+
+// Next reads next record, it returns false when there are no records left
+// or an error occurred, use Err to check it.
+func (z *ZoneReader) Next(rec *Record) bool {
+	rr, ok := z.zp.Next()
+	if !ok {
+		return false
+	}
+
+	*rec = newRecord(rr)
+
+	return true
+}
+
+// Err returns the first error occurred while reading.
+func (z *ZoneReader) Err() error {
+	return z.zp.Err()
+}
+
+// Results reads all the remaining records and groups them by name
+// into results in order of first appearance. Records of types
+// which are not in Types are skipped.
+func (z *ZoneReader) Results() ([]Result, error) {
+	names := make([]string, 0)
+	rrs := make(map[string][]dns.RR)
+
+	for rr, ok := z.zp.Next(); ok; rr, ok = z.zp.Next() {
+		name := strings.TrimSuffix(strings.ToLower(rr.Header().Name), ".")
+
+		if _, ok := rrs[name]; !ok {
+			names = append(names, name)
+		}
+
+		rrs[name] = append(rrs[name], rr)
+	}
+
+	if err := z.zp.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make([]Result, 0, len(names))
+
+	for _, name := range names {
+		r := Result{
+			Name:    name,
+			Answers: make(map[string][]string),
+		}
+
+		for _, qtype := range Types {
+			if a := answers(rrs[name], qtype); len(a) > 0 {
+				r.Answers[qtype] = a
+			}
+		}
+
+		if len(r.Answers) > 0 {
+			res = append(res, r)
+		}
+	}
+
+	return res, nil
+}
+
+// Records returns result answers as resource records with the given TTL.
+// Values which are not kept in result (e.g. MX preference or SRV port)
+// are set to zero.
+func (r *Result) Records(ttl uint32) []Record {
+	res := make([]Record, 0)
+
+	for _, qtype := range Types {
+		for _, v := range r.Answers[qtype] {
+			if rr := newRR(r.Name, ttl, qtype, v); rr != nil {
+				res = append(res, newRecord(rr))
+			}
+		}
+	}
+
+	return res
+}
+
+func newRR(name string, ttl uint32, qtype string, value string) dns.RR {
+	hdr := dns.RR_Header{
+		Name:   dns.Fqdn(name),
+		Rrtype: qtypeMap[qtype],
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+	}
+
+	switch qtype {
+	case TypeA:
+		return &dns.A{Hdr: hdr, A: net.ParseIP(value)}
+	case TypeAAAA:
+		return &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(value)}
+	case TypeNS:
+		return &dns.NS{Hdr: hdr, Ns: dns.Fqdn(value)}
+	case TypeMX:
+		return &dns.MX{Hdr: hdr, Mx: dns.Fqdn(value)}
+	case TypeTXT:
+		return &dns.TXT{Hdr: hdr, Txt: []string{value}}
+	case TypeSRV:
+		return &dns.SRV{Hdr: hdr, Target: dns.Fqdn(value)}
+	case TypeCNAME:
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(value)}
+	case TypePTR:
+		return &dns.PTR{Hdr: hdr, Ptr: dns.Fqdn(value)}
+	}
+
+	return nil
+}
+
+type zoneWriter struct {
+	out io.Writer
+	ttl uint32
+}
+
+// NewZoneWriter returns writer which writes results and records
+// in master file format. TTL is used for results records.
+func NewZoneWriter(out io.Writer, ttl uint32) output.Writer {
+	return &zoneWriter{
+		out: out,
+		ttl: ttl,
+	}
+}
+
+func (w *zoneWriter) Write(value interface{}) error {
+	var records []Record
+
+	switch v := value.(type) {
+	case Result:
+		records = v.Records(w.ttl)
+	case *Result:
+		records = v.Records(w.ttl)
+	case Record:
+		records = []Record{v}
+	case *Record:
+		records = []Record{*v}
+	default:
+		return fmt.Errorf("zone: unsupported value type %T", value)
+	}
+
+	for _, rec := range records {
+		if _, err := fmt.Fprintln(w.out, rec.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteDig writes full DNS response in dig-like text format.
+func WriteDig(w io.Writer, msg *dns.Msg, ns net.IP, rtt time.Duration) error {
+	_, err := fmt.Fprintf(w, "%s\n;; Query time: %d msec\n;; SERVER: %s#%d(%s)\n;; WHEN: %s\n;; MSG SIZE  rcvd: %d\n\n",
+		msg.String(),
+		rtt.Milliseconds(),
+		ns, port, ns,
+		time.Now().Format(time.UnixDate),
+		msg.Len())
+
+	return err
+}
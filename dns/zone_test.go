@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const zone = `$ORIGIN example.com.
+$TTL 3600
+@       IN  NS    ns1
+@       IN  MX    10 mail
+www     IN  A     1.1.1.1
+www     IN  A     2.2.2.2
+ns1     300 IN A  3.3.3.3
+txt     IN  TXT   "hello world"
+alias   IN  CNAME www
+`
+
+func TestZoneReader_Next(t *testing.T) {
+	z := NewZoneReader(strings.NewReader(zone), "")
+
+	var rec Record
+	records := make([]Record, 0)
+
+	for z.Next(&rec) {
+		records = append(records, rec)
+	}
+
+	require.NoError(t, z.Err())
+	require.Len(t, records, 7)
+
+	assert.Equal(t, Record{"example.com", 3600, TypeMX, "10 mail.example.com."}, records[1])
+	assert.Equal(t, Record{"ns1.example.com", 300, TypeA, "3.3.3.3"}, records[4])
+	assert.Equal(t, "txt.example.com.\t3600\tIN\tTXT\t\"hello world\"", records[5].String())
+}
+
+func TestZoneReader_Error(t *testing.T) {
+	z := NewZoneReader(strings.NewReader("www IN A invalid\n"), "example.com")
+
+	var rec Record
+
+	assert.False(t, z.Next(&rec))
+	assert.Error(t, z.Err())
+}
+
+func TestZone_RoundTrip(t *testing.T) {
+	results, err := NewZoneReader(strings.NewReader(zone), "").Results()
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	assert.Equal(t, Result{
+		Name:    "www.example.com",
+		Answers: map[string][]string{TypeA: {"1.1.1.1", "2.2.2.2"}},
+	}, results[1])
+
+	var buf bytes.Buffer
+	w := NewZoneWriter(&buf, 60)
+
+	for _, r := range results {
+		require.NoError(t, w.Write(r))
+	}
+
+	results2, err := NewZoneReader(&buf, "").Results()
+	require.NoError(t, err)
+
+	assert.Equal(t, results, results2)
+}
+
+func TestWriteDig(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Answer = append(msg.Answer, newRR("example.com", 60, TypeA, "1.1.1.1"))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDig(&buf, msg, net.ParseIP("8.8.8.8"), 15*time.Millisecond))
+
+	out := buf.String()
+	assert.Contains(t, out, ";; ANSWER SECTION:\nexample.com.\t60\tIN\tA\t1.1.1.1")
+	assert.Contains(t, out, ";; Query time: 15 msec")
+	assert.Contains(t, out, ";; SERVER: 8.8.8.8#53(8.8.8.8)")
+}
@@ -12,10 +12,13 @@ type linesIterator struct {
 	path       string
 	lines      chan string
 	linesCount int
+	position   int
 	scanner    *bufio.Scanner
 	file       *os.File
 }
 
+var _ iter.Seeker = &linesIterator{}
+
 // NewLinesIterator returns new file reader.
 func NewLinesIterator(path string) (iter.Iterator, error) {
 	file, err := os.Open(path)
@@ -47,6 +50,7 @@ func (r *linesIterator) Next(line *string) bool {
 
 	for r.scanner.Scan() {
 		*line = r.scanner.Text()
+		r.position++
 		return true
 	}
 
@@ -62,6 +66,35 @@ func (r *linesIterator) Close() error {
 func (r *linesIterator) Reset() {
 	r.file.Seek(0, os.SEEK_SET)
 	r.scanner = bufio.NewScanner(r.file)
+	r.position = 0
+}
+
+// Position returns number of read lines.
+func (r *linesIterator) Position() uint64 {
+	return uint64(r.position)
+}
+
+// Seek skips lines from the beginning of file,
+// so the next read line is line number pos.
+func (r *linesIterator) Seek(pos uint64) error {
+	if pos > uint64(r.linesCount) {
+		return iter.ErrSeekRange
+	}
+
+	r.Reset()
+
+	var line string
+
+	for uint64(r.position) < pos {
+		if !r.Next(&line) {
+			if err := r.scanner.Err(); err != nil {
+				return err
+			}
+			return iter.ErrSeekRange
+		}
+	}
+
+	return nil
 }
 
 // Count returns lines count in the reader.
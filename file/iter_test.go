@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/russtone/utils/file"
+	"github.com/russtone/utils/iter"
 )
 
 func TestLinesIterator(t *testing.T) {
@@ -92,3 +93,26 @@ func TestLinesIterator(t *testing.T) {
 		})
 	}
 }
+
+func TestLinesIterator_Seek(t *testing.T) {
+	it, err := file.NewLinesIterator("test/lines10")
+	require.NoError(t, err)
+	defer it.Close()
+
+	s := it.(iter.Seeker)
+
+	var line string
+
+	require.NoError(t, s.Seek(7))
+	assert.Equal(t, uint64(7), s.Position())
+
+	res := make([]string, 0)
+	for it.Next(&line) {
+		res = append(res, line)
+	}
+
+	assert.Equal(t, []string{"8", "9", "10"}, res)
+	assert.Equal(t, uint64(10), s.Position())
+
+	assert.Error(t, s.Seek(11))
+}
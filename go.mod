@@ -1,10 +1,19 @@
 module github.com/russtone/utils
 
-go 1.15
+go 1.21
 
 require (
 	github.com/go-ozzo/ozzo-validation/v4 v4.2.2
 	github.com/miekg/dns v1.1.31
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/net v0.0.0-20190923162816-aa69164e4478
 	golang.org/x/sys v0.0.0-20200817085935-3ff754bf58a9
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.0 // indirect
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
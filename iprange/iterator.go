@@ -16,8 +16,13 @@ type iterator struct {
 
 	// Current IP.
 	cur net.IP
+
+	// Number of returned IPs.
+	pos uint64
 }
 
+var _ iter.Seeker = &iterator{}
+
 // NewIterator creates new iterator from IP ranges.
 // Iterator implements iter.Iterator interface.
 func NewIterator(rr ...IterableRange) iter.Iterator {
@@ -42,6 +47,7 @@ func (it *iterator) Next(out *string) bool {
 
 	if it.cur != nil {
 		*out = it.cur.String()
+		it.pos++
 		return true
 	}
 
@@ -63,6 +69,38 @@ func (it *iterator) Count() uint64 {
 func (it *iterator) Reset() {
 	it.cur = nil
 	it.idx = 0
+	it.pos = 0
+}
+
+// Position returns number of returned IP addresses.
+func (it *iterator) Position() uint64 {
+	return it.pos
+}
+
+// Seek sets the iterator position, so the next returned IP
+// is IP with index pos. Whole ranges are skipped using their
+// count, IPs inside of a range are skipped one by one.
+func (it *iterator) Seek(pos uint64) error {
+	if pos > it.Count() {
+		return iter.ErrSeekRange
+	}
+
+	it.Reset()
+
+	left := pos
+
+	for it.idx < len(it.rr) && left >= it.rr[it.idx].Count() {
+		left -= it.rr[it.idx].Count()
+		it.idx++
+	}
+
+	for ; left > 0; left-- {
+		it.cur = it.rr[it.idx].next(it.cur)
+	}
+
+	it.pos = pos
+
+	return nil
 }
 
 // Close do nothing.
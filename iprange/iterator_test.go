@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/russtone/utils/iprange"
+	"github.com/russtone/utils/iter"
 )
 
 func TestIterator(t *testing.T) {
@@ -99,3 +100,41 @@ func TestIterator(t *testing.T) {
 		})
 	}
 }
+
+func TestIterator_Seek(t *testing.T) {
+	rr := make([]iprange.IterableRange, 0)
+
+	for _, rng := range []string{"10.0.0.1", "10.0.1.0/30", "10.0.2.1-3"} {
+		r, err := iprange.Parse(rng)
+		require.NoError(t, err)
+
+		rr = append(rr, r)
+	}
+
+	it := iprange.NewIterator(rr...).(iter.Seeker)
+
+	all := make([]string, 0)
+
+	var ip string
+
+	for it.Next(&ip) {
+		all = append(all, ip)
+	}
+
+	assert.Equal(t, uint64(len(all)), it.Position())
+
+	for pos := 0; pos <= len(all); pos++ {
+		require.NoError(t, it.Seek(uint64(pos)))
+		assert.Equal(t, uint64(pos), it.Position())
+
+		res := make([]string, 0)
+
+		for it.Next(&ip) {
+			res = append(res, ip)
+		}
+
+		assert.Equal(t, all[pos:], res)
+	}
+
+	assert.Error(t, it.Seek(uint64(len(all)+1)))
+}
@@ -7,6 +7,8 @@ type combined struct {
 	idx   int
 }
 
+var _ Seeker = &combined{}
+
 func Combine(iterators ...Iterator) Iterator {
 	return &combined{iterators, 0}
 }
@@ -35,6 +37,50 @@ func (it *combined) Count() uint64 {
 	return count
 }
 
+func (it *combined) Position() uint64 {
+	pos := uint64(0)
+
+	for _, item := range it.items {
+		if s, ok := item.(Seeker); ok {
+			pos += s.Position()
+		}
+	}
+
+	return pos
+}
+
+// Seek seeks all the combined iterators, so it requires
+// all of them to implement Seeker.
+func (it *combined) Seek(pos uint64) error {
+	if pos > it.Count() {
+		return ErrSeekRange
+	}
+
+	for _, item := range it.items {
+		s, ok := item.(Seeker)
+		if !ok {
+			return ErrNotSeekable
+		}
+
+		count := s.Count()
+
+		if pos >= count {
+			if err := s.Seek(count); err != nil {
+				return err
+			}
+			pos -= count
+			continue
+		}
+
+		if err := s.Seek(pos); err != nil {
+			return err
+		}
+		pos = 0
+	}
+
+	return nil
+}
+
 func (it *combined) Close() error {
 	ee := make(errors.Errors, 0)
 
@@ -49,3 +49,26 @@ func Test_Combined(t *testing.T) {
 		assert.NoError(t, it.Close())
 	}
 }
+
+func Test_Combined_Seek(t *testing.T) {
+	all := []string{"1", "2", "3", "4", "5"}
+
+	it := iter.Combine(iter.Slice(all[:2]), iter.Slice(all[2:])).(iter.Seeker)
+
+	for pos := 0; pos <= len(all); pos++ {
+		assert.NoError(t, it.Seek(uint64(pos)))
+		assert.Equal(t, uint64(pos), it.Position())
+
+		var s string
+		res := make([]string, 0)
+
+		for it.Next(&s) {
+			res = append(res, s)
+		}
+
+		assert.Equal(t, all[pos:], res)
+		assert.Equal(t, uint64(len(all)), it.Position())
+	}
+
+	assert.Equal(t, iter.ErrSeekRange, it.Seek(6))
+}
@@ -1,8 +1,32 @@
 package iter
 
+import "errors"
+
+var (
+	// ErrNotSeekable is returned when seeking an iterator
+	// which does not implement Seeker.
+	ErrNotSeekable = errors.New("iterator is not seekable")
+
+	// ErrSeekRange is returned when seeking beyond the last item.
+	ErrSeekRange = errors.New("seek position out of range")
+)
+
 type Iterator interface {
 	Next(*string) bool
 	Reset()
 	Count() uint64
 	Close() error
 }
+
+// Seeker is an iterator which can report and restore its position.
+type Seeker interface {
+	Iterator
+
+	// Position returns number of items returned by Next since
+	// the beginning of the iterator.
+	Position() uint64
+
+	// Seek sets position of the iterator, so the next call to Next
+	// returns item with index pos.
+	Seek(pos uint64) error
+}
@@ -5,6 +5,8 @@ type slice struct {
 	idx   int
 }
 
+var _ Seeker = &slice{}
+
 func Slice(items []string) Iterator {
 	return &slice{items, 0}
 }
@@ -30,3 +32,17 @@ func (it *slice) Count() uint64 {
 func (it *slice) Close() error {
 	return nil
 }
+
+func (it *slice) Position() uint64 {
+	return uint64(it.idx)
+}
+
+func (it *slice) Seek(pos uint64) error {
+	if pos > uint64(len(it.items)) {
+		return ErrSeekRange
+	}
+
+	it.idx = int(pos)
+
+	return nil
+}
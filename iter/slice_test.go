@@ -32,3 +32,16 @@ func Test_Slice(t *testing.T) {
 		assert.NoError(t, it.Close())
 	}
 }
+
+func Test_Slice_Seek(t *testing.T) {
+	it := iter.Slice([]string{"one", "two", "three"}).(iter.Seeker)
+
+	var s string
+
+	assert.NoError(t, it.Seek(1))
+	assert.True(t, it.Next(&s))
+	assert.Equal(t, "two", s)
+	assert.Equal(t, uint64(2), it.Position())
+
+	assert.Equal(t, iter.ErrSeekRange, it.Seek(4))
+}
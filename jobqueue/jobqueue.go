@@ -1,18 +1,28 @@
 package jobqueue
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"sync"
-	"sync/atomic"
 	"time"
+
+	"github.com/russtone/utils/jobqueue/typed"
 )
 
 var (
 	ErrInvalidJob = errors.New("invalid job")
 )
 
+// RetryAfter returns error which delays the next attempt of the job
+// by d, see typed.RetryAfter.
+func RetryAfter(err error, d time.Duration) error {
+	return typed.RetryAfter(err, d)
+}
+
+// Queue is a job queue of untyped jobs. It is an adapter to typed.Queue
+// kept for compatibility, new code should use typed.Queue directly.
 type Queue interface {
 	Add(delta int)
 	Schedule(job interface{})
@@ -31,25 +41,52 @@ type Queue interface {
 	Speed() float64
 }
 
-type Processor interface {
-	Process(interface{}) (interface{}, bool, error)
+// ControlledQueue is a Queue with runtime control and statistics,
+// queues returned by New implement it.
+type ControlledQueue interface {
+	Queue
+
+	Pause()
+	Resume()
+	State() State
+
+	// Outcomes returns stream of jobs outcomes, see typed.Queue.Outcomes.
+	// It must be called before Start.
+	Outcomes() <-chan Outcome
+
+	SetWorkers(n int)
+	Workers() int
+
+	Stats() Stats
 }
 
-type queue struct {
-	processor Processor
+// Outcome represents final outcome of an untyped job, see typed.Outcome.
+type Outcome = typed.Outcome[interface{}, interface{}]
 
-	workersCount int
-	workersWG    sync.WaitGroup
+// State is a state of the queue, see typed.State.
+type State = typed.State
+
+// Stats is a snapshot of the queue statistics, see typed.Stats.
+type Stats = typed.Stats
+
+// Processor processes untyped jobs, see typed.Processor.
+type Processor interface {
+	Process(interface{}) (interface{}, bool, error)
+}
 
-	jobsWG        sync.WaitGroup
-	jobsCount     uint64
-	jobsProcessed uint64
+// Middleware wraps untyped processor, see typed.Middleware.
+type Middleware = typed.Middleware[interface{}, interface{}]
 
-	todo chan job
-	done chan interface{}
-	errs chan error
+// Chain wraps processor with middlewares, see typed.Chain.
+func Chain(p Processor, mws ...Middleware) Processor {
+	return typed.Chain[interface{}, interface{}](p, mws...)
+}
 
-	createdAt time.Time
+// queue adapts typed.Queue to the Queue interface.
+type queue struct {
+	q            *typed.Queue[job, interface{}]
+	outcomes     chan Outcome
+	outcomesOnce sync.Once
 }
 
 type job struct {
@@ -57,33 +94,38 @@ type job struct {
 	dest interface{}
 }
 
-func New(processor Processor, workersCount int, capacity int) Queue {
-	return &queue{
-		processor:    processor,
-		workersCount: workersCount,
-		todo:         make(chan job, capacity),
-		done:         make(chan interface{}, capacity),
-		errs:         make(chan error, capacity),
-		createdAt:    time.Now(),
-	}
+func New(processor Processor, workersCount int, capacity int) ControlledQueue {
+	jq := &queue{}
+
+	jq.q = typed.New[job, interface{}](typed.ProcessorFunc[job, interface{}](func(j job) (interface{}, bool, error) {
+		res, retry, err := processor.Process(j.job)
+
+		if err == nil && !retry && j.dest != nil {
+			jq.setDest(j.dest, res)
+		}
+
+		return res, retry, err
+	}), workersCount, capacity)
+
+	return jq
 }
 
 func (jq *queue) Add(delta int) {
-	atomic.AddUint64(&jq.jobsCount, uint64(delta))
-	jq.jobsWG.Add(delta)
+	jq.q.Add(delta)
 }
 
 func (jq *queue) Schedule(j interface{}) {
-	jq.todo <- job{job: j, dest: nil}
+	jq.q.Schedule(job{job: j, dest: nil})
 }
 
 func (jq *queue) ScheduleDest(j interface{}, dest interface{}) {
-	jq.todo <- job{job: j, dest: dest}
+	jq.q.Schedule(job{job: j, dest: dest})
 }
 
 func (jq *queue) Next(dest interface{}) bool {
-	res, ok := <-jq.done
-	if !ok {
+	var res interface{}
+
+	if !jq.q.Next(&res) {
 		return false
 	}
 
@@ -93,87 +135,78 @@ func (jq *queue) Next(dest interface{}) bool {
 }
 
 func (jq *queue) Err(e *error) bool {
-	err, ok := <-jq.errs
-	if !ok {
-		return false
-	}
+	return jq.q.Err(e)
+}
 
-	*e = err
-	return true
+func (jq *queue) Outcomes() <-chan Outcome {
+	jq.outcomesOnce.Do(func() {
+		in := jq.q.Outcomes()
+		jq.outcomes = make(chan Outcome, cap(in))
+
+		go func() {
+			defer close(jq.outcomes)
+
+			for o := range in {
+				jq.outcomes <- Outcome{
+					Job:      o.Job.job,
+					Result:   o.Result,
+					Err:      o.Err,
+					Attempts: o.Attempts,
+					Duration: o.Duration,
+				}
+			}
+		}()
+	})
+
+	return jq.outcomes
 }
 
 func (jq *queue) Start() {
-	for i := 0; i < jq.workersCount; i++ {
-		jq.workersWG.Add(1)
-		go jq.worker(i)
-	}
-
-	go func() {
-		jq.workersWG.Wait()
-		close(jq.done)
-		close(jq.errs)
-	}()
+	jq.q.Start(context.Background())
 }
 
 func (jq *queue) Stop() {
-	close(jq.todo)
+	jq.q.Stop()
 }
 
-func (jq *queue) WaitWorkers() {
-	jq.workersWG.Wait()
+func (jq *queue) Pause() {
+	jq.q.Pause()
 }
 
-func (jq *queue) WaitJobs() {
-	jq.jobsWG.Wait()
+func (jq *queue) Resume() {
+	jq.q.Resume()
 }
 
-func (jq *queue) Progress() float64 {
-	processed := atomic.LoadUint64(&jq.jobsProcessed)
-	return float64(processed) / float64(jq.jobsCount)
+func (jq *queue) State() State {
+	return jq.q.State()
 }
 
-func (jq *queue) Speed() float64 {
-	return float64(jq.jobsProcessed) / time.Since(jq.createdAt).Seconds()
+func (jq *queue) WaitWorkers() {
+	jq.q.WaitWorkers()
 }
 
-func (jq *queue) worker(id int) {
-	defer jq.workersWG.Done()
-
-	for j := range jq.todo {
-		jq.process(j)
-	}
+func (jq *queue) WaitJobs() {
+	jq.q.WaitJobs()
 }
 
-func (jq *queue) process(j job) {
-	res, retry, err := jq.processor.Process(j.job)
-
-	if err != nil {
-		jq.errs <- err
-	}
-
-	if retry {
-		jq.retry(j)
-		return
-	}
-
-	jq.jobsWG.Done()
-	atomic.AddUint64(&jq.jobsProcessed, 1)
+func (jq *queue) SetWorkers(n int) {
+	jq.q.SetWorkers(n)
+}
 
-	if err != nil {
-		return
-	}
+func (jq *queue) Workers() int {
+	return jq.q.Workers()
+}
 
-	if j.dest != nil {
-		jq.setDest(j.dest, res)
-	}
+func (jq *queue) Progress() float64 {
+	return jq.q.Progress()
+}
 
-	jq.done <- res
+func (jq *queue) Speed() float64 {
+	return jq.q.Speed()
 }
 
-func (jq *queue) retry(j job) {
-	go func() {
-		jq.todo <- j
-	}()
+func (jq *queue) Stats() Stats {
+	return jq.q.Stats()
 }
 
 func (jq *queue) setDest(destination interface{}, result interface{}) {
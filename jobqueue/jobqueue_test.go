@@ -1,6 +1,7 @@
 package jobqueue_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/russtone/utils/jobqueue"
+	"github.com/russtone/utils/jobqueue/typed"
 )
 
 type ProcessorMock struct {
@@ -197,3 +199,127 @@ func TestJobqueue(t *testing.T) {
 	}
 
 }
+
+func TestJobqueue_Outcomes(t *testing.T) {
+	proc := &ProcessorMock{errID: 3}
+	proc.On("Process", mock.Anything).Return()
+
+	// Capacity 1 and nobody reads errors: without outcomes stream
+	// workers would block on sending an error.
+	queue := jobqueue.New(proc, 2, 1)
+	outcomes := queue.Outcomes()
+
+	queue.Start()
+
+	go func() {
+		queue.Add(10)
+
+		for i := 0; i < 10; i++ {
+			queue.Schedule(&Job{ID: i})
+		}
+
+		queue.WaitJobs()
+		queue.Stop()
+	}()
+
+	count := 0
+
+	for o := range outcomes {
+		count++
+
+		job := o.Job.(*Job)
+
+		assert.NoError(t, o.Err)
+		assert.Equal(t, Result{job}, o.Result)
+
+		if job.ID == 3 {
+			assert.Equal(t, 2, o.Attempts)
+		} else {
+			assert.Equal(t, 1, o.Attempts)
+		}
+	}
+
+	assert.Equal(t, 10, count)
+}
+
+func TestJobqueue_Chain(t *testing.T) {
+	proc := &ProcessorMock{errID: -1}
+	proc.On("Process", mock.Anything).Return()
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	count := func(next typed.ContextProcessor[interface{}, interface{}]) typed.ContextProcessor[interface{}, interface{}] {
+		return typed.ContextProcessorFunc[interface{}, interface{}](func(ctx context.Context, j interface{}) (interface{}, bool, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return next.ProcessContext(ctx, j)
+		})
+	}
+
+	queue := jobqueue.New(jobqueue.Chain(proc, count), 2, 10)
+	outcomes := queue.Outcomes()
+
+	queue.Start()
+	queue.Add(5)
+
+	for i := 0; i < 5; i++ {
+		queue.Schedule(&Job{ID: i})
+	}
+
+	queue.Stop()
+
+	n := 0
+	for o := range outcomes {
+		assert.NoError(t, o.Err)
+		n++
+	}
+
+	assert.Equal(t, 5, n)
+	assert.Equal(t, 5, calls)
+}
+
+func TestJobqueue_OutcomesConcurrent(t *testing.T) {
+	proc := &ProcessorMock{errID: -1}
+	proc.On("Process", mock.Anything).Return()
+
+	queue := jobqueue.New(proc, 2, 10)
+
+	chans := make([]<-chan jobqueue.Outcome, 4)
+
+	var wg sync.WaitGroup
+
+	for i := range chans {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			chans[i] = queue.Outcomes()
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, ch := range chans {
+		assert.Equal(t, chans[0], ch)
+	}
+
+	queue.Start()
+	queue.Add(3)
+
+	for i := 0; i < 3; i++ {
+		queue.Schedule(&Job{ID: i})
+	}
+
+	queue.Stop()
+
+	count := 0
+	for range chans[0] {
+		count++
+	}
+
+	assert.Equal(t, 3, count)
+}
@@ -0,0 +1,215 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBatchResults is an error of jobs whose batch processor returned
+// wrong number of results.
+var ErrBatchResults = errors.New("wrong number of batch results")
+
+// BatchResult is a result of a single job of a batch.
+type BatchResult[R any] struct {
+	// Value is the job result.
+	Value R
+
+	// Retry is true if the job must be retried.
+	Retry bool
+
+	// Err is the job error.
+	Err error
+}
+
+// BatchProcessor processes jobs in batches. It must return exactly one
+// result for every job in the same order. Context is cancelled when
+// all the jobs of the batch are cancelled, see Processor.
+type BatchProcessor[J, R any] interface {
+	ProcessBatch(context.Context, []J) []BatchResult[R]
+}
+
+// BatchProcessorFunc is an adapter to use ordinary functions
+// as BatchProcessor.
+type BatchProcessorFunc[J, R any] func(context.Context, []J) []BatchResult[R]
+
+// ProcessBatch calls f(ctx, jobs).
+func (f BatchProcessorFunc[J, R]) ProcessBatch(ctx context.Context, jobs []J) []BatchResult[R] {
+	return f(ctx, jobs)
+}
+
+// NewBatch returns new queue which processes jobs in batches of up to
+// size jobs with up to the given number of batches at once, see Batch.
+func NewBatch[J, R any](p BatchProcessor[J, R], size int, wait time.Duration, batches int, capacity int) *Queue[J, R] {
+	if size < 1 {
+		size = 1
+	}
+
+	return New[J, R](Batch(p, size, wait), size*batches, capacity)
+}
+
+// Batch returns processor which gathers jobs processed concurrently by
+// queue workers into batches of up to size jobs. Incomplete batch is
+// processed when wait passes since its first job. Every worker waits
+// for its job of the batch, so the queue must have at least size
+// workers to make full batches. Results are mapped back to jobs, so
+// retries, outcomes and progress work as usual.
+func Batch[J, R any](p BatchProcessor[J, R], size int, wait time.Duration) ContextProcessor[J, R] {
+	if size < 1 {
+		size = 1
+	}
+
+	return &batcher[J, R]{
+		processor: p,
+		size:      size,
+		wait:      wait,
+	}
+}
+
+// batcher is a processor which gathers jobs into batches.
+type batcher[J, R any] struct {
+	processor BatchProcessor[J, R]
+	size      int
+	wait      time.Duration
+
+	mu      sync.Mutex
+	pending []batchItem[J, R]
+	timer   *time.Timer
+
+	// gen is incremented on every taken batch,
+	// so stale timers do not flush the next one.
+	gen uint64
+}
+
+type batchItem[J, R any] struct {
+	ctx    context.Context
+	job    J
+	result chan BatchResult[R]
+}
+
+var _ ContextProcessor[int, int] = &batcher[int, int]{}
+
+// Process calls ProcessContext with background context.
+func (b *batcher[J, R]) Process(j J) (R, bool, error) {
+	return b.ProcessContext(context.Background(), j)
+}
+
+// ProcessContext adds job to the current batch and waits for its result.
+func (b *batcher[J, R]) ProcessContext(ctx context.Context, j J) (R, bool, error) {
+	item := batchItem[J, R]{
+		ctx:    ctx,
+		job:    j,
+		result: make(chan BatchResult[R], 1),
+	}
+
+	b.mu.Lock()
+
+	b.pending = append(b.pending, item)
+
+	var full []batchItem[J, R]
+
+	switch {
+	case len(b.pending) >= b.size:
+		full = b.take()
+	case len(b.pending) == 1:
+		gen := b.gen
+		b.timer = time.AfterFunc(b.wait, func() {
+			b.flush(gen)
+		})
+	}
+
+	b.mu.Unlock()
+
+	if full != nil {
+		b.run(full)
+	}
+
+	select {
+	case r := <-item.result:
+		return r.Value, r.Retry, r.Err
+	case <-ctx.Done():
+		var zero R
+		return zero, false, ctx.Err()
+	}
+}
+
+// take returns pending items as a batch, mu must be held.
+func (b *batcher[J, R]) take() []batchItem[J, R] {
+	items := b.pending
+	b.pending = nil
+	b.gen++
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	return items
+}
+
+// flush processes incomplete batch of the given generation.
+func (b *batcher[J, R]) flush(gen uint64) {
+	b.mu.Lock()
+
+	if gen != b.gen || len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	items := b.take()
+	b.mu.Unlock()
+
+	b.run(items)
+}
+
+// run processes batch and sends results to the waiting workers.
+func (b *batcher[J, R]) run(items []batchItem[J, R]) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Batch context is cancelled when nobody waits for it.
+	left := int64(len(items))
+	jobs := make([]J, len(items))
+
+	for i, item := range items {
+		jobs[i] = item.job
+
+		stop := context.AfterFunc(item.ctx, func() {
+			if atomic.AddInt64(&left, -1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+	}
+
+	results := b.process(ctx, jobs)
+
+	for i, item := range items {
+		if len(results) != len(items) {
+			item.result <- BatchResult[R]{Err: ErrBatchResults}
+			continue
+		}
+
+		item.result <- results[i]
+	}
+}
+
+// process calls batch processor and recovers its panic
+// into PanicError of every job.
+func (b *batcher[J, R]) process(ctx context.Context, jobs []J) (results []BatchResult[R]) {
+	defer func() {
+		if v := recover(); v != nil {
+			err := &PanicError{Value: v, Stack: debug.Stack()}
+
+			results = make([]BatchResult[R], len(jobs))
+			for i := range results {
+				results[i].Err = err
+			}
+		}
+	}()
+
+	return b.processor.ProcessBatch(ctx, jobs)
+}
@@ -0,0 +1,184 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestNewBatch(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		sizes []int
+	)
+
+	retried := sync.Map{}
+
+	// Doubles jobs, fails on jobs divisible by 7
+	// and retries jobs divisible by 5 once.
+	p := typed.BatchProcessorFunc[int, int](func(ctx context.Context, jobs []int) []typed.BatchResult[int] {
+		mu.Lock()
+		sizes = append(sizes, len(jobs))
+		mu.Unlock()
+
+		results := make([]typed.BatchResult[int], len(jobs))
+
+		for i, j := range jobs {
+			switch {
+			case j%7 == 0:
+				results[i].Err = errTest
+			case j%5 == 0:
+				if _, ok := retried.LoadOrStore(j, true); !ok {
+					results[i].Retry = true
+					continue
+				}
+				fallthrough
+			default:
+				results[i].Value = j * 2
+			}
+		}
+
+		return results
+	})
+
+	q := typed.NewBatch[int, int](p, 5, 20*time.Millisecond, 1, 100)
+	assert.Equal(t, 0, q.Workers())
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+	assert.Equal(t, 5, q.Workers())
+
+	q.Add(12)
+	for j := 1; j <= 12; j++ {
+		q.Schedule(j)
+	}
+	q.Stop()
+
+	res := make(map[int]typed.Outcome[int, int])
+	for o := range outcomes {
+		res[o.Job] = o
+	}
+
+	waitDone(t, q)
+
+	require.Len(t, res, 12)
+
+	for j := 1; j <= 12; j++ {
+		o := res[j]
+
+		switch {
+		case j%7 == 0:
+			assert.Equal(t, errTest, o.Err)
+		case j%5 == 0:
+			assert.Equal(t, 2, o.Attempts)
+			assert.Equal(t, j*2, o.Result)
+		default:
+			assert.NoError(t, o.Err)
+			assert.Equal(t, j*2, o.Result)
+		}
+	}
+
+	// 12 jobs and 2 retries.
+	total := 0
+	for _, n := range sizes {
+		assert.True(t, n <= 5)
+		total += n
+	}
+
+	assert.Equal(t, 14, total)
+	assert.Equal(t, float64(1), q.Progress())
+	assert.Equal(t, uint64(1), q.Stats().Failed)
+}
+
+func TestBatch_Wait(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		sizes []int
+	)
+
+	p := typed.BatchProcessorFunc[int, int](func(ctx context.Context, jobs []int) []typed.BatchResult[int] {
+		mu.Lock()
+		sizes = append(sizes, len(jobs))
+		mu.Unlock()
+		return make([]typed.BatchResult[int], len(jobs))
+	})
+
+	q := typed.NewBatch[int, int](p, 10, 10*time.Millisecond, 2, 100)
+
+	start := time.Now()
+	runJobs(t, q, make([]int, 13))
+
+	sort.Ints(sizes)
+
+	assert.Equal(t, []int{3, 10}, sizes)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
+
+func TestBatch_Errors(t *testing.T) {
+	for name, p := range map[string]typed.BatchProcessorFunc[int, int]{
+		"results": func(ctx context.Context, jobs []int) []typed.BatchResult[int] {
+			return nil
+		},
+		"panic": func(ctx context.Context, jobs []int) []typed.BatchResult[int] {
+			panic("boom")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q := typed.New[int, int](typed.Batch[int, int](p, 3, time.Millisecond), 3, 10)
+
+			outcomes := collectOutcomes(t, q, 5)
+			require.Len(t, outcomes, 5)
+
+			for _, o := range outcomes {
+				require.Error(t, o.Err)
+
+				var pe *typed.PanicError
+				assert.True(t, o.Err == typed.ErrBatchResults || errors.As(o.Err, &pe), o.Err)
+			}
+		})
+	}
+}
+
+func TestBatch_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := typed.BatchProcessorFunc[int, int](func(ctx context.Context, jobs []int) []typed.BatchResult[int] {
+		<-ctx.Done()
+
+		results := make([]typed.BatchResult[int], len(jobs))
+		for i := range results {
+			results[i].Err = ctx.Err()
+		}
+
+		return results
+	})
+
+	q := typed.NewBatch[int, int](p, 2, time.Millisecond, 1, 10)
+	outcomes := q.Outcomes()
+
+	q.Start(ctx)
+	q.Add(4)
+	for j := 0; j < 4; j++ {
+		q.Schedule(j)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	count := 0
+	for o := range outcomes {
+		assert.True(t, errors.Is(o.Err, context.Canceled))
+		count++
+	}
+
+	waitDone(t, q)
+	assert.Equal(t, 4, count)
+}
@@ -0,0 +1,305 @@
+package typed
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBreakerOpen is the error of jobs failed fast by open circuit breaker.
+var ErrBreakerOpen = errors.New("jobqueue: circuit breaker is open")
+
+// minBreakerDelay is the minimum delay of deferred jobs,
+// so they do not spin while the probe is in flight.
+const minBreakerDelay = 10 * time.Millisecond
+
+// BreakerState is a state of circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed is a state of breaker which lets jobs through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen is a state of breaker which fails fast or defers
+	// jobs until cooldown is passed.
+	BreakerOpen
+
+	// BreakerHalfOpen is a state of breaker after cooldown, it lets
+	// a single probe job through: its success closes the breaker and
+	// its failure opens it again.
+	BreakerHalfOpen
+)
+
+var breakerStateNames = map[BreakerState]string{
+	BreakerClosed:   "closed",
+	BreakerOpen:     "open",
+	BreakerHalfOpen: "half-open",
+}
+
+func (s BreakerState) String() string {
+	if name, ok := breakerStateNames[s]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Breaker is a circuit breaker configuration, see SetBreaker.
+type Breaker struct {
+	// Failures is the number of consecutive failed attempts which
+	// opens the breaker. Values less than 1 are treated as 1.
+	Failures int
+
+	// Cooldown is the time the breaker stays open before a probe.
+	Cooldown time.Duration
+
+	// Defer makes jobs of open breaker wait for the probe instead
+	// of failing with ErrBreakerOpen.
+	Defer bool
+
+	// If limits failures to errors it returns true for.
+	// Nil means any error is a failure.
+	If func(error) bool
+}
+
+// BreakerEvent is a state change of circuit breaker, see Hooks.Breaker.
+type BreakerEvent struct {
+	// Key is the breaker key.
+	Key string
+
+	// From and To are the previous and the new states.
+	From BreakerState
+	To   BreakerState
+
+	// Err is the error which opened the breaker.
+	Err error
+
+	// Time is the time of the change.
+	Time time.Time
+}
+
+// SetBreaker enables circuit breakers keyed by the key of job: breaker
+// opens after the number of consecutive failed attempts of its key and
+// then jobs of the key are failed fast with ErrBreakerOpen or deferred,
+// so they do not waste retries. After cooldown a single probe job is
+// let through. State changes are reported to Hooks.Breaker.
+// Must be called before Start.
+func (q *Queue[J, R]) SetBreaker(key func(J) string, b Breaker) {
+	q.breakerKey = key
+	q.breakers = newBreakers(b)
+}
+
+// Breaker returns state of the circuit breaker of the key.
+func (q *Queue[J, R]) Breaker(key string) BreakerState {
+	if q.breakers == nil {
+		return BreakerClosed
+	}
+
+	return q.breakers.state(key)
+}
+
+// breaker is a circuit breaker state of a key.
+type breaker struct {
+	state    BreakerState
+	failures int
+	until    time.Time
+
+	// probing is true while the probe job is in flight.
+	probing bool
+}
+
+// breakers are circuit breakers by key. Keys of closed breakers
+// without failures are removed, so only failing keys are kept.
+type breakers struct {
+	mu sync.Mutex
+
+	cfg  Breaker
+	keys map[string]*breaker
+}
+
+func newBreakers(b Breaker) *breakers {
+	if b.Failures < 1 {
+		b.Failures = 1
+	}
+
+	return &breakers{cfg: b, keys: make(map[string]*breaker)}
+}
+
+func (bs *breakers) state(key string) BreakerState {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if b, ok := bs.keys[key]; ok {
+		return b.state
+	}
+
+	return BreakerClosed
+}
+
+// allow returns true if job of the key can be processed, otherwise
+// it returns time to wait for the next probe. Open breaker after
+// cooldown becomes half-open and lets the job through as a probe.
+func (bs *breakers) allow(key string, now time.Time) (bool, time.Duration, *BreakerEvent) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	b, ok := bs.keys[key]
+	if !ok {
+		return true, 0, nil
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		if now.Before(b.until) {
+			return false, b.until.Sub(now), nil
+		}
+
+		b.state = BreakerHalfOpen
+		b.probing = true
+
+		return true, 0, &BreakerEvent{Key: key, From: BreakerOpen, To: BreakerHalfOpen, Time: now}
+
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, bs.cfg.Cooldown, nil
+		}
+
+		b.probing = true
+	}
+
+	return true, 0, nil
+}
+
+// done records result of the attempt of the key
+// and returns state change if any.
+func (bs *breakers) done(key string, err error, now time.Time) *BreakerEvent {
+	failed := err != nil && (bs.cfg.If == nil || bs.cfg.If(err))
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	b, ok := bs.keys[key]
+
+	if !failed {
+		if !ok || b.state == BreakerOpen {
+			return nil
+		}
+
+		delete(bs.keys, key)
+
+		if b.state == BreakerHalfOpen {
+			return &BreakerEvent{Key: key, From: BreakerHalfOpen, To: BreakerClosed, Time: now}
+		}
+
+		return nil
+	}
+
+	if !ok {
+		b = &breaker{}
+		bs.keys[key] = b
+	}
+
+	b.failures++
+
+	if b.state == BreakerOpen || b.state == BreakerClosed && b.failures < bs.cfg.Failures {
+		return nil
+	}
+
+	e := &BreakerEvent{Key: key, From: b.state, To: BreakerOpen, Err: err, Time: now}
+
+	b.state = BreakerOpen
+	b.probing = false
+	b.until = now.Add(bs.cfg.Cooldown)
+
+	return e
+}
+
+// release lets another probe through if the probe of the key
+// was interrupted without result.
+func (bs *breakers) release(key string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if b, ok := bs.keys[key]; ok {
+		b.probing = false
+	}
+}
+
+// admit checks circuit breaker of the task key and returns true
+// if the task can be processed. Otherwise the task is deferred
+// or failed fast with ErrBreakerOpen.
+func (q *Queue[J, R]) admit(t task[J]) bool {
+	if q.breakers == nil {
+		return true
+	}
+
+	ok, wait, e := q.breakers.allow(q.breakerKey(t.job), time.Now())
+	if e != nil {
+		q.hooks.breaker(*e)
+	}
+
+	if ok {
+		return true
+	}
+
+	atomic.AddUint64(&q.tripped, 1)
+
+	if q.breakers.cfg.Defer {
+		if wait < minBreakerDelay {
+			wait = minBreakerDelay
+		}
+
+		if !q.todo.retry(t, wait) {
+			q.cancelTask(t)
+		}
+
+		return false
+	}
+
+	q.jobsWG.Done()
+	atomic.AddUint64(&q.jobsProcessed, 1)
+	atomic.AddUint64(&t.group.processed, 1)
+	atomic.AddUint64(&q.failed, 1)
+	atomic.AddUint64(&q.rejected, 1)
+	atomic.AddUint64(&t.group.rejected, 1)
+
+	if q.outcomes == nil {
+		q.errs <- ErrBreakerOpen
+	}
+
+	q.hooks.finished(Event[J, R]{
+		Job:     t.job,
+		Err:     ErrBreakerOpen,
+		Attempt: t.attempts,
+		Total:   t.duration,
+	})
+
+	q.deliver(t.seq, Outcome[J, R]{
+		Job:      t.job,
+		Err:      ErrBreakerOpen,
+		Attempts: t.attempts,
+		Duration: t.duration,
+	})
+
+	return false
+}
+
+// trip records result of the attempt in the circuit breaker
+// of the task key, interrupted attempts are not counted.
+func (q *Queue[J, R]) trip(t task[J], err error, interrupted bool) {
+	if q.breakers == nil {
+		return
+	}
+
+	key := q.breakerKey(t.job)
+
+	if interrupted {
+		q.breakers.release(key)
+		return
+	}
+
+	if e := q.breakers.done(key, err, time.Now()); e != nil {
+		q.hooks.breaker(*e)
+	}
+}
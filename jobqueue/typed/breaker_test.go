@@ -0,0 +1,183 @@
+package typed_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// parity returns key of job: "odd" or "even".
+func parity(j int) string {
+	if j%2 == 1 {
+		return "odd"
+	}
+	return "even"
+}
+
+func TestQueue_SetBreaker(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []typed.BreakerEvent
+	)
+
+	// Odd jobs always fail.
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j%2 == 1 {
+			return 0, false, errTest
+		}
+		return j, false, nil
+	}), 1, 100)
+
+	q.SetBreaker(parity, typed.Breaker{Failures: 3, Cooldown: time.Hour})
+	q.SetHooks(typed.Hooks[int, int]{
+		Breaker: func(e typed.BreakerEvent) {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		},
+	})
+
+	outcomes := collectOutcomes(t, q, 20)
+
+	failed, tripped := 0, 0
+
+	for j, o := range outcomes {
+		switch {
+		case j%2 == 0:
+			assert.NoError(t, o.Err)
+		case o.Err == typed.ErrBreakerOpen:
+			assert.Equal(t, 0, o.Attempts)
+			tripped++
+		default:
+			assert.Equal(t, errTest, o.Err)
+			failed++
+		}
+	}
+
+	assert.Equal(t, 3, failed)
+	assert.Equal(t, 7, tripped)
+	s := q.Stats()
+	assert.Equal(t, uint64(7), s.Tripped)
+	assert.Equal(t, uint64(7), s.Rejected)
+	assert.Equal(t, uint64(3), s.Errors)
+	assert.Equal(t, uint64(10), s.Failed)
+
+	assert.Equal(t, typed.BreakerOpen, q.Breaker("odd"))
+	assert.Equal(t, typed.BreakerClosed, q.Breaker("even"))
+
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "odd", events[0].Key)
+		assert.Equal(t, typed.BreakerClosed, events[0].From)
+		assert.Equal(t, typed.BreakerOpen, events[0].To)
+		assert.Equal(t, errTest, events[0].Err)
+	}
+}
+
+func TestQueue_SetBreakerGroupStats(t *testing.T) {
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		return 0, false, errTest
+	}), 1, 10)
+
+	q.SetBreaker(parity, typed.Breaker{Failures: 1, Cooldown: time.Hour})
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	g := q.Group("g", 1)
+	g.Add(5)
+
+	for j := 0; j < 5; j++ {
+		g.Schedule(2 * j)
+	}
+
+	q.Stop()
+
+	for o := range outcomes {
+		assert.Error(t, o.Err)
+	}
+
+	s := g.Stats()
+	assert.Equal(t, uint64(5), s.Processed)
+	assert.Equal(t, uint64(1), s.Errors)
+	assert.Equal(t, uint64(4), s.Rejected)
+}
+
+func TestQueue_SetBreakerDefer(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		calls  int
+		events []string
+	)
+
+	// The target fails twice and then recovers.
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if calls <= 2 {
+			return 0, false, errTest
+		}
+		return j, false, nil
+	}), 1, 100)
+
+	q.SetBreaker(func(int) string { return "target" }, typed.Breaker{
+		Failures: 1,
+		Cooldown: 20 * time.Millisecond,
+		Defer:    true,
+	})
+	q.SetHooks(typed.Hooks[int, int]{
+		Breaker: func(e typed.BreakerEvent) {
+			mu.Lock()
+			events = append(events, e.From.String()+" -> "+e.To.String())
+			mu.Unlock()
+		},
+	})
+
+	outcomes := collectOutcomes(t, q, 5)
+
+	errs := 0
+	for _, o := range outcomes {
+		if o.Err != nil {
+			assert.Equal(t, errTest, o.Err)
+			errs++
+		}
+	}
+
+	assert.Equal(t, 2, errs)
+	assert.Equal(t, 5, calls)
+	assert.True(t, q.Stats().Tripped > 0)
+	assert.Equal(t, typed.BreakerClosed, q.Breaker("target"))
+
+	assert.Equal(t, []string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}, events)
+}
+
+func TestQueue_SetBreakerIf(t *testing.T) {
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		return 0, false, errTest
+	}), 2, 100)
+
+	q.SetBreaker(func(j int) string { return strconv.Itoa(j % 3) }, typed.Breaker{
+		Failures: 1,
+		Cooldown: time.Hour,
+		If:       typed.RetryOn(typed.ErrTimeout),
+	})
+
+	for _, o := range collectOutcomes(t, q, 30) {
+		assert.Equal(t, errTest, o.Err)
+	}
+
+	assert.Equal(t, uint64(0), q.Stats().Tripped)
+}
@@ -0,0 +1,134 @@
+package typed
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Checkpoint is a serializable state of the queue, it requires
+// jobs to be serializable with encoding/json.
+//
+// Checkpoint assumes that jobs are created from an input one by one,
+// so Position, the number of jobs scheduled with Schedule, is also the
+// position of the input (e.g. iter.Seeker) to resume from. Completed jobs
+// are never in Jobs, but a job can be both counted as completed and kept
+// in Jobs if it completes while the checkpoint is taken, so resumed queue
+// processes every job at least once.
+type Checkpoint[J any] struct {
+	// Position is the number of scheduled jobs.
+	Position uint64 `json:"position"`
+
+	// Completed is the number of processed jobs.
+	Completed uint64 `json:"completed"`
+
+	// Jobs are scheduled jobs which are not processed yet:
+	// pending, in-flight and cancelled ones.
+	Jobs []J `json:"jobs"`
+}
+
+// LoadCheckpoint reads checkpoint from file.
+func LoadCheckpoint[J any](path string) (Checkpoint[J], error) {
+	var cp Checkpoint[J]
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return cp, err
+	}
+
+	return cp, nil
+}
+
+// Save atomically writes checkpoint to file.
+func (cp Checkpoint[J]) Save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Checkpoint returns the current state of the queue.
+func (q *Queue[J, R]) Checkpoint() Checkpoint[J] {
+	position, jobs := q.todo.snapshot()
+
+	return Checkpoint[J]{
+		Position:  position,
+		Completed: atomic.LoadUint64(&q.jobsProcessed),
+		Jobs:      jobs,
+	}
+}
+
+// SetCheckpoint enables saving checkpoint to the file every interval
+// and when the queue is finished, see CheckpointErr for saving errors.
+// Must be called before Start.
+func (q *Queue[J, R]) SetCheckpoint(path string, interval time.Duration) {
+	q.checkpointPath = path
+	q.checkpointInterval = interval
+}
+
+// CheckpointErr returns error of the last checkpoint saving.
+func (q *Queue[J, R]) CheckpointErr() error {
+	if err := q.checkpointErr.Load(); err != nil {
+		return *err
+	}
+
+	return nil
+}
+
+// Restore restores the queue from checkpoint: jobs from the checkpoint
+// are scheduled again and counters are restored. Restored jobs are added
+// to the expected number of jobs, so only jobs from the input after
+// checkpoint position must be added with Add.
+// Must be called before Start.
+func (q *Queue[J, R]) Restore(cp Checkpoint[J]) {
+	atomic.AddUint64(&q.jobsCount, cp.Completed+uint64(len(cp.Jobs)))
+	atomic.AddUint64(&q.jobsProcessed, cp.Completed)
+	q.jobsWG.Add(len(cp.Jobs))
+
+	q.todo.restore(cp.Position, cp.Jobs)
+}
+
+// saveCheckpoint saves checkpoint to the file.
+func (q *Queue[J, R]) saveCheckpoint() {
+	err := q.Checkpoint().Save(q.checkpointPath)
+	q.checkpointErr.Store(&err)
+}
+
+// checkpointer saves checkpoint every interval until the queue is finished.
+func (q *Queue[J, R]) checkpointer() {
+	ticker := time.NewTicker(q.checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.saveCheckpoint()
+		case <-q.finished:
+			return
+		}
+	}
+}
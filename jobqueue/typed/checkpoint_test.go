@@ -0,0 +1,109 @@
+package typed_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/iter"
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+type scanJob struct {
+	N int `json:"n"`
+}
+
+func scanItems(n int) []string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+	return items
+}
+
+func TestCheckpoint_Restore(t *testing.T) {
+	const total = 50
+
+	path := filepath.Join(t.TempDir(), "checkpoint")
+
+	var (
+		mu        sync.Mutex
+		processed = make(map[int]int)
+	)
+
+	// First run is "crashed" with cancel after crashAt jobs.
+	run := func(ctx context.Context, cancel func(), crashAt int, it iter.Seeker) *typed.Queue[scanJob, int] {
+		q := typed.New[scanJob, int](typed.ContextProcessorFunc[scanJob, int](func(ctx context.Context, j scanJob) (int, bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if ctx.Err() != nil {
+				return 0, false, ctx.Err()
+			}
+
+			processed[j.N]++
+
+			if len(processed) == crashAt {
+				cancel()
+			}
+
+			return j.N, false, nil
+		}), 2, 5)
+
+		q.SetCheckpoint(path, time.Millisecond)
+
+		cp, err := typed.LoadCheckpoint[scanJob](path)
+		if err == nil {
+			q.Restore(cp)
+			require.NoError(t, it.Seek(cp.Position))
+		} else {
+			require.True(t, os.IsNotExist(err))
+		}
+
+		q.Start(ctx)
+
+		q.Feed(it, func(s string) scanJob {
+			n, _ := strconv.Atoi(s)
+			return scanJob{N: n}
+		})
+
+		var res int
+		for q.Next(&res) {
+		}
+
+		<-q.Done()
+		require.NoError(t, q.CheckpointErr())
+
+		return q
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := run(ctx, cancel, 20, iter.Slice(scanItems(total)).(iter.Seeker))
+	assert.True(t, q.Progress() < 1)
+
+	cp, err := typed.LoadCheckpoint[scanJob](path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), cp.Completed)
+	assert.True(t, cp.Position >= 20)
+	assert.Equal(t, int(cp.Position)-20, len(cp.Jobs))
+
+	q = run(context.Background(), func() {}, -1, iter.Slice(scanItems(total)).(iter.Seeker))
+	assert.Equal(t, float64(1), q.Progress())
+
+	require.Len(t, processed, total)
+
+	for n, count := range processed {
+		assert.Equal(t, 1, count, n)
+	}
+
+	cp, err = typed.LoadCheckpoint[scanJob](path)
+	require.NoError(t, err)
+	assert.Equal(t, typed.Checkpoint[scanJob]{Position: total, Completed: total, Jobs: []scanJob{}}, cp)
+}
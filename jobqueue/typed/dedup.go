@@ -0,0 +1,135 @@
+package typed
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Deduper remembers keys of scheduled jobs, see SetDedup.
+// It must be safe for concurrent use.
+type Deduper interface {
+	// Seen remembers the key and returns true if it was seen before.
+	Seen(key string) bool
+}
+
+// Set is an exact Deduper which keeps all the keys in memory.
+type Set struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+var _ Deduper = &Set{}
+
+// NewSet returns new empty Set.
+func NewSet() *Set {
+	return &Set{
+		keys: make(map[string]struct{}),
+	}
+}
+
+// Seen implements Deduper.
+func (s *Set) Seen(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; ok {
+		return true
+	}
+
+	s.keys[key] = struct{}{}
+
+	return false
+}
+
+// Bloom is a Deduper with fixed memory size based on Bloom filter.
+// It never misses a duplicate, but it can take a new key for
+// a duplicate with the configured probability, so such jobs are skipped.
+type Bloom struct {
+	mu     sync.Mutex
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+var _ Deduper = &Bloom{}
+
+// NewBloom returns Bloom sized for n keys with the given
+// false positive probability, e.g. 0.001.
+func NewBloom(n uint64, p float64) *Bloom {
+	if n < 1 {
+		n = 1
+	}
+
+	if p <= 0 || p >= 1 {
+		p = 0.001
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+
+	if k < 1 {
+		k = 1
+	}
+
+	return &Bloom{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		hashes: k,
+	}
+}
+
+// Seen implements Deduper.
+func (b *Bloom) Seen(key string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+
+	// Second hash for double hashing, it must be odd,
+	// so all the positions are different.
+	h2 := (h1>>33 | h1<<31) | 1
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seen := true
+
+	for i := uint64(0); i < b.hashes; i++ {
+		pos := (h1 + i*h2) % b.m
+		word, bit := pos/64, uint64(1)<<(pos%64)
+
+		if b.bits[word]&bit == 0 {
+			seen = false
+			b.bits[word] |= bit
+		}
+	}
+
+	return seen
+}
+
+// SetDedup enables skipping of jobs whose key returned by fn is seen
+// by d before. Skipped jobs are removed from the expected number of jobs
+// and counted in Stats.Duplicates. Retries are never skipped.
+// Must be called before Start.
+func (q *Queue[J, R]) SetDedup(fn func(J) string, d Deduper) {
+	q.dedupKey = fn
+	q.deduper = d
+}
+
+// duplicate returns true if the task must be skipped as a duplicate.
+func (q *Queue[J, R]) duplicate(t task[J]) bool {
+	if q.deduper == nil || !q.deduper.Seen(q.dedupKey(t.job)) {
+		return false
+	}
+
+	atomic.AddUint64(&q.duplicates, 1)
+	q.todo.skip()
+	q.Add(-1)
+
+	if t.group != nil {
+		atomic.AddUint64(&t.group.jobs, ^uint64(0))
+	}
+
+	return true
+}
@@ -0,0 +1,77 @@
+package typed_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestSet(t *testing.T) {
+	s := typed.NewSet()
+
+	assert.False(t, s.Seen("a"))
+	assert.False(t, s.Seen("b"))
+	assert.True(t, s.Seen("a"))
+	assert.True(t, s.Seen("b"))
+}
+
+func TestBloom(t *testing.T) {
+	const n = 10000
+
+	b := typed.NewBloom(n, 0.01)
+
+	falsePositives := 0
+
+	for i := 0; i < n; i++ {
+		if b.Seen(fmt.Sprintf("key-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		assert.True(t, b.Seen(fmt.Sprintf("key-%d", i)))
+	}
+
+	assert.True(t, falsePositives < n/50, falsePositives)
+}
+
+func TestQueue_SetDedup(t *testing.T) {
+	for name, d := range map[string]typed.Deduper{
+		"set":   typed.NewSet(),
+		"bloom": typed.NewBloom(100, 0.0001),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Job 3 is retried once.
+			q := typed.New[int, int](newProcessor(-1, 3), 2, 100)
+			q.SetDedup(func(j int) string { return fmt.Sprint(j) }, d)
+
+			outcomes := q.Outcomes()
+			q.Start(context.Background())
+
+			q.Add(20)
+			for j := 0; j < 20; j++ {
+				q.Schedule(j % 10)
+			}
+
+			q.Stop()
+
+			attempts := make(map[int]int)
+			for o := range outcomes {
+				attempts[o.Job] += o.Attempts
+			}
+
+			assert.Len(t, attempts, 10)
+			assert.Equal(t, 2, attempts[3])
+
+			s := q.Stats()
+			assert.Equal(t, uint64(10), s.Duplicates)
+			assert.Equal(t, uint64(10), s.Jobs)
+			assert.Equal(t, float64(1), s.Progress())
+			assert.Equal(t, uint64(20), q.Checkpoint().Position)
+		})
+	}
+}
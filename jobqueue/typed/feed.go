@@ -0,0 +1,53 @@
+package typed
+
+import "github.com/russtone/utils/iter"
+
+// Feed schedules a job made by fn for every item of it in background.
+// It adds the number of items to the expected number of jobs, so there is
+// no need to call Add. If it implements iter.Seeker only items after
+// the current position are counted, so it works with Restore.
+// When the input runs out or the queue is cancelled, Feed closes
+// the iterator and stops the queue.
+//
+// The returned channel receives iterator closing error, if any,
+// and is closed when feeding is finished.
+func (q *Queue[J, R]) Feed(it iter.Iterator, fn func(string) J) <-chan error {
+	expected := it.Count()
+
+	if s, ok := it.(iter.Seeker); ok {
+		expected -= s.Position()
+	}
+
+	q.Add(int(expected))
+
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+
+		scheduled := uint64(0)
+
+		var s string
+
+		for scheduled < expected && it.Next(&s) {
+			scheduled++
+
+			if !q.schedule(fn(s)) {
+				break
+			}
+		}
+
+		// Input is shorter than it said or the queue is cancelled.
+		if scheduled < expected {
+			q.Add(-int(expected - scheduled))
+		}
+
+		if err := it.Close(); err != nil {
+			errs <- err
+		}
+
+		q.Stop()
+	}()
+
+	return errs
+}
@@ -0,0 +1,87 @@
+package typed_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/iter"
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+type closeErrIterator struct {
+	iter.Iterator
+	closed bool
+}
+
+func (it *closeErrIterator) Close() error {
+	it.closed = true
+	return errTest
+}
+
+func TestQueue_Feed(t *testing.T) {
+	it := &closeErrIterator{Iterator: iter.Slice([]string{"a", "bb", "ccc", "dddd"})}
+
+	q := typed.New[string, int](typed.ProcessorFunc[string, int](func(s string) (int, bool, error) {
+		return len(s), false, nil
+	}), 2, 1)
+
+	q.Start(context.Background())
+
+	errs := q.Feed(it, func(s string) string {
+		return s + s
+	})
+
+	sum := 0
+
+	var n int
+	for q.Next(&n) {
+		sum += n
+	}
+
+	q.WaitJobs()
+
+	assert.Equal(t, 20, sum)
+	assert.Equal(t, float64(1), q.Progress())
+	assert.True(t, it.closed)
+	assert.Equal(t, []error{errTest}, collect(errs))
+}
+
+func TestQueue_FeedCancel(t *testing.T) {
+	items := scanItems(1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := typed.New[string, string](typed.ProcessorFunc[string, string](func(s string) (string, bool, error) {
+		if s == "10" {
+			cancel()
+		}
+		return s, false, nil
+	}), 1, 1)
+
+	stream := q.Outcomes()
+
+	q.Start(ctx)
+
+	errs := q.Feed(iter.Slice(items), func(s string) string { return s })
+
+	outcomes := 0
+	for range stream {
+		outcomes++
+	}
+
+	// Must not hang.
+	q.WaitJobs()
+
+	assert.Empty(t, collect(errs))
+	assert.True(t, len(q.Cancelled()) < len(items)-outcomes)
+}
+
+func collect(errs <-chan error) []error {
+	res := make([]error, 0)
+	for err := range errs {
+		res = append(res, err)
+	}
+	return res
+}
@@ -0,0 +1,183 @@
+package typed
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Group is a named group of jobs of the queue, e.g. jobs of a single
+// tenant. Workers are shared between groups with the same priority jobs
+// in proportion to their weights, so a big group does not starve
+// the others. Jobs scheduled to the queue itself belong to the default
+// group of weight 1.
+type Group[J, R any] struct {
+	q *Queue[J, R]
+	g *group[J]
+}
+
+// GroupStats is a snapshot of the group statistics.
+type GroupStats struct {
+	// Name is the group name.
+	Name string
+
+	// Weight is the group weight.
+	Weight int
+
+	// Jobs is the expected number of jobs, see Group.Add.
+	Jobs uint64
+
+	// Processed is the number of processed jobs,
+	// including failed and cancelled ones.
+	Processed uint64
+
+	// Errors is the number of attempts failed with an error,
+	// see Stats.Errors.
+	Errors uint64
+
+	// Rejected is the number of jobs failed fast with ErrBreakerOpen.
+	Rejected uint64
+
+	// Queued is the number of jobs waiting to be processed.
+	Queued int
+
+	// InFlight is the number of jobs being processed.
+	InFlight int
+
+	// Cancelled is true if the group is cancelled.
+	Cancelled bool
+}
+
+// Progress returns ratio of processed jobs to expected jobs.
+func (s GroupStats) Progress() float64 {
+	if s.Jobs == 0 {
+		return 0
+	}
+
+	return float64(s.Processed) / float64(s.Jobs)
+}
+
+// Group returns the group with the given name, creating it if required.
+// Weight less than 1 is treated as 1, existing group is returned as is.
+func (q *Queue[J, R]) Group(name string, weight int) *Group[J, R] {
+	if weight < 1 {
+		weight = 1
+	}
+
+	q.groupsMu.Lock()
+	defer q.groupsMu.Unlock()
+
+	if g, ok := q.groups[name]; ok {
+		return g
+	}
+
+	if q.groups == nil {
+		q.groups = make(map[string]*Group[J, R])
+	}
+
+	g := &Group[J, R]{q: q, g: q.todo.newGroup(name, weight)}
+	q.groups[name] = g
+
+	return g
+}
+
+// Name returns the group name.
+func (g *Group[J, R]) Name() string {
+	return g.g.name
+}
+
+// Add adds delta to the expected number of jobs of the group
+// and of the queue, see Queue.Add.
+func (g *Group[J, R]) Add(delta int) {
+	atomic.AddUint64(&g.g.jobs, uint64(delta))
+	g.q.Add(delta)
+}
+
+// Schedule adds job to the group with zero priority,
+// see Queue.Schedule.
+func (g *Group[J, R]) Schedule(j J) {
+	g.SchedulePriority(j, 0)
+}
+
+// SchedulePriority adds job to the group with the given priority,
+// see Queue.SchedulePriority. Jobs scheduled to cancelled group
+// are cancelled right away.
+func (g *Group[J, R]) SchedulePriority(j J, priority int) {
+	g.q.scheduleTask(task[J]{job: j, group: g.g, priority: priority})
+}
+
+// Cancel cancels all the jobs of the group which are not processed yet,
+// other groups are not affected. Context-aware processors get cancelled
+// context for in-flight jobs of the group. Cancelled jobs get outcome
+// with context.Canceled error and are counted as processed. Outcomes
+// are sent by workers, so Cancel does not block and can be called
+// from the outcomes consumer.
+func (g *Group[J, R]) Cancel() {
+	g.q.todo.cancelGroup(g.g)
+}
+
+// Cancelled returns jobs which were not processed because
+// the group was cancelled. Spilled jobs are added as they are
+// read back, see SetSpill.
+func (g *Group[J, R]) Cancelled() []J {
+	return g.q.todo.groupCancelledJobs(g.g)
+}
+
+// Progress returns ratio of processed jobs of the group
+// to expected jobs of the group.
+func (g *Group[J, R]) Progress() float64 {
+	return g.Stats().Progress()
+}
+
+// Stats returns snapshot of the group statistics.
+func (g *Group[J, R]) Stats() GroupStats {
+	queued, inflight := g.q.todo.groupCounts(g.g)
+
+	return GroupStats{
+		Name:      g.g.name,
+		Weight:    g.g.weight,
+		Jobs:      atomic.LoadUint64(&g.g.jobs),
+		Processed: atomic.LoadUint64(&g.g.processed),
+		Errors:    atomic.LoadUint64(&g.g.errors),
+		Rejected:  atomic.LoadUint64(&g.g.rejected),
+		Queued:    queued,
+		InFlight:  inflight,
+		Cancelled: g.g.ctx.Err() != nil,
+	}
+}
+
+// jobContext returns context for processing of the task which is
+// cancelled when either the queue or the task group is cancelled.
+func (q *Queue[J, R]) jobContext(t task[J]) (context.Context, context.CancelFunc) {
+	if t.group == q.todo.def {
+		return q.ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(q.ctx)
+	stop := context.AfterFunc(t.group.ctx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// cancelTask reports task of cancelled group as processed.
+func (q *Queue[J, R]) cancelTask(t task[J]) {
+	q.jobsWG.Done()
+	atomic.AddUint64(&q.jobsProcessed, 1)
+	atomic.AddUint64(&t.group.processed, 1)
+
+	q.hooks.finished(Event[J, R]{
+		Job:     t.job,
+		Err:     context.Canceled,
+		Attempt: t.attempts,
+		Total:   t.duration,
+	})
+
+	q.deliver(t.seq, Outcome[J, R]{
+		Job:      t.job,
+		Err:      context.Canceled,
+		Attempts: t.attempts,
+		Duration: t.duration,
+	})
+}
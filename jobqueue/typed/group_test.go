@@ -0,0 +1,212 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func identity(j int) (int, bool, error) {
+	return j, false, nil
+}
+
+func TestQueue_SchedulePriority(t *testing.T) {
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 100)
+	outcomes := q.Outcomes()
+
+	q.Pause()
+	q.Start(context.Background())
+
+	g := q.Group("urgent", 1)
+
+	q.Add(6)
+	q.Schedule(1)
+	q.Schedule(2)
+	q.SchedulePriority(3, 1)
+	g.SchedulePriority(4, 2)
+	g.Schedule(5)
+	q.SchedulePriority(6, 2)
+
+	q.Stop()
+	q.Resume()
+
+	var order []int
+	for o := range outcomes {
+		order = append(order, o.Job)
+	}
+
+	assert.Equal(t, []int{6, 4, 3, 5, 1, 2}, order)
+}
+
+func TestQueue_Group(t *testing.T) {
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 100)
+	outcomes := q.Outcomes()
+
+	q.Pause()
+	q.Start(context.Background())
+
+	a, b := q.Group("a", 1), q.Group("b", 3)
+	assert.Equal(t, a, q.Group("a", 10))
+
+	a.Add(40)
+	b.Add(40)
+
+	for j := 0; j < 40; j++ {
+		a.Schedule(j)
+		b.Schedule(100 + j)
+	}
+
+	assert.Equal(t, 40, b.Stats().Queued)
+
+	q.Stop()
+	q.Resume()
+
+	count := 0
+	fromB := 0
+
+	for o := range outcomes {
+		if count < 40 && o.Job >= 100 {
+			fromB++
+		}
+		count++
+	}
+
+	waitDone(t, q)
+
+	assert.Equal(t, 80, count)
+	assert.InDelta(t, 30, fromB, 1)
+
+	s := b.Stats()
+	assert.Equal(t, "b", s.Name)
+	assert.Equal(t, 3, s.Weight)
+	assert.Equal(t, uint64(40), s.Processed)
+	assert.Equal(t, 0, s.Queued)
+	assert.Equal(t, float64(1), a.Progress())
+}
+
+func TestGroup_Cancel(t *testing.T) {
+	started := make(chan struct{})
+
+	q := typed.New[int, int](typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+		if j == 100 {
+			close(started)
+			<-ctx.Done()
+			return 0, false, ctx.Err()
+		}
+		return j, false, nil
+	}), 1, 100)
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	a, b := q.Group("a", 1), q.Group("b", 1)
+
+	a.Add(6)
+	a.Schedule(100)
+	<-started
+
+	b.Add(5)
+	for j := 1; j < 5; j++ {
+		a.Schedule(100 + j)
+		b.Schedule(200 + j)
+	}
+
+	a.Cancel()
+	a.Schedule(105)
+	b.Schedule(205)
+
+	q.Stop()
+
+	res := make(map[int]error)
+	for o := range outcomes {
+		res[o.Job] = o.Err
+	}
+
+	waitDone(t, q)
+
+	require.Len(t, res, 11)
+
+	for j := 0; j < 6; j++ {
+		assert.True(t, errors.Is(res[100+j], context.Canceled), j)
+	}
+
+	for j := 1; j < 6; j++ {
+		assert.NoError(t, res[200+j])
+	}
+
+	assert.ElementsMatch(t, []int{100, 101, 102, 103, 104, 105}, a.Cancelled())
+	assert.Empty(t, b.Cancelled())
+	assert.Empty(t, q.Cancelled())
+
+	s := a.Stats()
+	assert.True(t, s.Cancelled)
+	assert.Equal(t, float64(1), s.Progress())
+	assert.False(t, b.Stats().Cancelled)
+	assert.Equal(t, float64(1), q.Progress())
+}
+
+func TestGroup_CancelFromConsumer(t *testing.T) {
+	// Jobs of the group are retried after an hour,
+	// so they are delayed and not limited by capacity.
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j >= 100 {
+			return 0, true, errTest
+		}
+		return j, false, nil
+	}), 1, 5)
+
+	q.SetRetryPolicy(typed.Retry{Backoff: typed.Constant(time.Hour)})
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	a := q.Group("a", 1)
+
+	a.Add(20)
+	for j := 0; j < 20; j++ {
+		a.Schedule(100 + j)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s := a.Stats(); s.Queued != 20 || s.InFlight != 0; s = a.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatal("jobs are not delayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	q.Add(1)
+	q.Schedule(0)
+	q.Stop()
+
+	done := make(chan int)
+
+	go func() {
+		count := 0
+
+		for o := range outcomes {
+			// More jobs are cancelled than fit in outcomes buffer.
+			if o.Job == 0 {
+				a.Cancel()
+			}
+			count++
+		}
+
+		done <- count
+	}()
+
+	select {
+	case count := <-done:
+		assert.Equal(t, 21, count)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel from consumer is blocked")
+	}
+
+	assert.Len(t, a.Cancelled(), 20)
+}
@@ -0,0 +1,96 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTimeout is an error of the job which exceeded timeout, see SetTimeout.
+var ErrTimeout = errors.New("job timeout")
+
+// PanicError is an error of the job whose processor panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicked goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// SetTimeout sets maximum time of a single job attempt. Context-aware
+// processors get context which is cancelled on timeout, other processors
+// are abandoned: the job fails with ErrTimeout while the processor call
+// still runs in background. Timed out jobs are retried only according
+// to the retry policy, see SetRetryPolicy. Zero means no timeout.
+// Must be called before Start.
+func (q *Queue[J, R]) SetTimeout(d time.Duration) {
+	q.timeout = d
+}
+
+type callResult[R any] struct {
+	res   R
+	retry bool
+	err   error
+}
+
+// invoke processes job with timeout, if it is set.
+func (q *Queue[J, R]) invoke(parent context.Context, j J) (R, bool, error) {
+	if q.timeout <= 0 {
+		return q.call(parent, j)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, q.timeout)
+	defer cancel()
+
+	// Buffered, so abandoned call does not block forever.
+	ch := make(chan callResult[R], 1)
+
+	go func() {
+		res, retry, err := q.call(ctx, j)
+		ch <- callResult[R]{res: res, retry: retry, err: err}
+	}()
+
+	var r callResult[R]
+
+	select {
+	case r = <-ch:
+		if r.err == nil || ctx.Err() == nil {
+			return r.res, r.retry, r.err
+		}
+	case <-ctx.Done():
+	}
+
+	if err := parent.Err(); err != nil {
+		return r.res, false, err
+	}
+
+	atomic.AddUint64(&q.timeouts, 1)
+
+	return r.res, q.retryPolicy != nil, ErrTimeout
+}
+
+// call processes job and recovers processor panic into PanicError.
+func (q *Queue[J, R]) call(ctx context.Context, j J) (res R, retry bool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			atomic.AddUint64(&q.panics, 1)
+
+			var zero R
+			res, retry, err = zero, false, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	if p, ok := q.processor.(ContextProcessor[J, R]); ok {
+		return p.ProcessContext(ctx, j)
+	}
+
+	return q.processor.Process(j)
+}
@@ -0,0 +1,143 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// collectOutcomes schedules jobs and returns outcomes by job.
+func collectOutcomes(t *testing.T, q *typed.Queue[int, int], jobs int) map[int]typed.Outcome[int, int] {
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+	q.Add(jobs)
+
+	for j := 0; j < jobs; j++ {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+
+	res := make(map[int]typed.Outcome[int, int])
+	for o := range outcomes {
+		res[o.Job] = o
+	}
+
+	waitDone(t, q)
+
+	return res
+}
+
+func TestQueue_Panic(t *testing.T) {
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j%3 == 0 {
+			panic("boom")
+		}
+		return j, false, nil
+	}), 1, 10)
+
+	outcomes := collectOutcomes(t, q, 10)
+	require.Len(t, outcomes, 10)
+
+	for j, o := range outcomes {
+		if j%3 != 0 {
+			assert.NoError(t, o.Err)
+			continue
+		}
+
+		var pe *typed.PanicError
+		require.True(t, errors.As(o.Err, &pe))
+		assert.Equal(t, "boom", pe.Value)
+		assert.Equal(t, "panic: boom", pe.Error())
+		assert.True(t, strings.Contains(string(pe.Stack), "TestQueue_Panic"))
+		assert.Equal(t, 1, o.Attempts)
+	}
+
+	s := q.Stats()
+	assert.Equal(t, uint64(4), s.Panics)
+	assert.Equal(t, uint64(4), s.Errors)
+	assert.Equal(t, uint64(10), s.Processed)
+}
+
+func TestQueue_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j == 0 {
+			<-block
+		}
+		return j, false, nil
+	}), 1, 10)
+
+	q.SetTimeout(10 * time.Millisecond)
+
+	outcomes := collectOutcomes(t, q, 5)
+	require.Len(t, outcomes, 5)
+
+	assert.Equal(t, typed.ErrTimeout, outcomes[0].Err)
+
+	for j := 1; j < 5; j++ {
+		assert.NoError(t, outcomes[j].Err)
+	}
+
+	assert.Equal(t, uint64(1), q.Stats().Timeouts)
+}
+
+func TestQueue_TimeoutContext(t *testing.T) {
+	var calls int64
+
+	q := typed.New[int, int](typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+		if atomic.AddInt64(&calls, 1) < 3 {
+			<-ctx.Done()
+			return 0, false, ctx.Err()
+		}
+
+		return j, false, nil
+	}), 1, 10)
+
+	q.SetTimeout(10 * time.Millisecond)
+	q.SetRetryPolicy(typed.Retry{MaxAttempts: 5})
+
+	outcomes := collectOutcomes(t, q, 1)
+	require.Len(t, outcomes, 1)
+
+	assert.NoError(t, outcomes[0].Err)
+	assert.Equal(t, 3, outcomes[0].Attempts)
+
+	s := q.Stats()
+	assert.Equal(t, uint64(2), s.Timeouts)
+	assert.Equal(t, uint64(2), s.Retries)
+}
+
+func TestQueue_TimeoutCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := typed.New[int, int](blocking(0), 1, 10)
+	q.SetTimeout(time.Minute)
+
+	outcomes := q.Outcomes()
+
+	q.Start(ctx)
+	q.Add(1)
+	q.Schedule(0)
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	o := <-outcomes
+	assert.True(t, errors.Is(o.Err, context.Canceled))
+
+	waitDone(t, q)
+	assert.Equal(t, []int{0}, q.Cancelled())
+	assert.Equal(t, uint64(0), q.Stats().Timeouts)
+}
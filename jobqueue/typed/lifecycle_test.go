@@ -0,0 +1,127 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// blocking returns processor which blocks until context is done
+// on the job equal to block.
+func blocking(block int) typed.ContextProcessorFunc[int, int] {
+	return func(ctx context.Context, j int) (int, bool, error) {
+		if j == block {
+			<-ctx.Done()
+			return 0, false, ctx.Err()
+		}
+		return j, false, nil
+	}
+}
+
+func waitDone(t *testing.T, q *typed.Queue[int, int]) {
+	select {
+	case <-q.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue is not finished")
+	}
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := typed.New[int, int](blocking(0), 1, 10)
+	outcomes := q.Outcomes()
+
+	q.Start(ctx)
+	q.Add(5)
+
+	for j := 0; j < 5; j++ {
+		q.Schedule(j)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	count := 0
+
+	for o := range outcomes {
+		count++
+		assert.True(t, errors.Is(o.Err, context.Canceled))
+	}
+
+	assert.Equal(t, 5, count)
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4}, q.Cancelled())
+
+	// Must not block or panic.
+	q.WaitJobs()
+	q.Add(1)
+	q.Schedule(5)
+	q.Stop()
+
+	waitDone(t, q)
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5}, q.Cancelled())
+}
+
+func TestQueue_Shutdown(t *testing.T) {
+	q := typed.New[int, int](blocking(-1), 2, 10)
+
+	q.Start(context.Background())
+	q.Add(10)
+
+	for j := 0; j < 10; j++ {
+		q.Schedule(j)
+	}
+
+	go func() {
+		var res int
+		for q.Next(&res) {
+		}
+	}()
+
+	require.NoError(t, q.Shutdown(context.Background()))
+	assert.Equal(t, float64(1), q.Progress())
+	assert.Empty(t, q.Cancelled())
+
+	// Shutdown must be idempotent.
+	require.NoError(t, q.Shutdown(context.Background()))
+}
+
+func TestQueue_ShutdownDeadline(t *testing.T) {
+	q := typed.New[int, int](blocking(3), 1, 10)
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+	q.Add(10)
+
+	for j := 0; j < 10; j++ {
+		q.Schedule(j)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := q.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	processed, cancelled := 0, 0
+
+	for o := range outcomes {
+		if o.Err == nil {
+			processed++
+		} else {
+			cancelled++
+		}
+	}
+
+	waitDone(t, q)
+
+	assert.Equal(t, 3, processed)
+	assert.Equal(t, 7, cancelled)
+	assert.Len(t, q.Cancelled(), 7)
+}
@@ -0,0 +1,136 @@
+package typed
+
+import (
+	"context"
+	"time"
+)
+
+// Middleware wraps processor with additional behaviour,
+// e.g. logging, metrics, caching or results filtering.
+type Middleware[J, R any] func(ContextProcessor[J, R]) ContextProcessor[J, R]
+
+// Chain wraps processor with middlewares,
+// the first middleware is the outermost one.
+func Chain[J, R any](p Processor[J, R], mws ...Middleware[J, R]) ContextProcessor[J, R] {
+	cp := withContext(p)
+
+	for i := len(mws) - 1; i >= 0; i-- {
+		cp = mws[i](cp)
+	}
+
+	return cp
+}
+
+// Use wraps the queue processor with middlewares, see Chain.
+// Must be called before Start.
+func (q *Queue[J, R]) Use(mws ...Middleware[J, R]) {
+	q.processor = Chain(q.processor, mws...)
+}
+
+// withContext returns processor as ContextProcessor,
+// plain processors ignore context.
+func withContext[J, R any](p Processor[J, R]) ContextProcessor[J, R] {
+	if cp, ok := p.(ContextProcessor[J, R]); ok {
+		return cp
+	}
+
+	return ContextProcessorFunc[J, R](func(_ context.Context, j J) (R, bool, error) {
+		return p.Process(j)
+	})
+}
+
+// Event is a job lifecycle event, see Hooks.
+type Event[J, R any] struct {
+	// Job is the job.
+	Job J
+
+	// Result is the result of the attempt.
+	Result R
+
+	// Err is the error of the attempt.
+	Err error
+
+	// Attempt is the number of the attempt starting from 1.
+	// It is the number of attempts made for cancelled jobs.
+	Attempt int
+
+	// Start is the start time of the attempt.
+	// It is zero for cancelled jobs.
+	Start time.Time
+
+	// Duration is the duration of the attempt.
+	Duration time.Duration
+
+	// Total is the total duration of all the finished attempts.
+	Total time.Duration
+
+	// Delay is the delay before the next attempt of retried job.
+	Delay time.Duration
+}
+
+// Hooks are functions called on jobs lifecycle events, nil hooks are
+// skipped. Hooks are called synchronously by workers, so they must be
+// fast and safe for concurrent use.
+type Hooks[J, R any] struct {
+	// Started is called before every attempt.
+	Started func(Event[J, R])
+
+	// Retried is called after attempt which is retried.
+	Retried func(Event[J, R])
+
+	// Finished is called when job is processed successfully.
+	Finished func(Event[J, R])
+
+	// Failed is called when job is finished with an error,
+	// including cancelled jobs.
+	Failed func(Event[J, R])
+
+	// Breaker is called on circuit breaker state changes,
+	// see SetBreaker.
+	Breaker func(BreakerEvent)
+
+	// Drained is called once when all the jobs are finished
+	// after the queue is stopped or cancelled, before outputs
+	// are closed.
+	Drained func()
+}
+
+// SetHooks sets jobs lifecycle hooks. Must be called before Start.
+func (q *Queue[J, R]) SetHooks(h Hooks[J, R]) {
+	q.hooks = h
+}
+
+func (h *Hooks[J, R]) started(e Event[J, R]) {
+	if h.Started != nil {
+		h.Started(e)
+	}
+}
+
+func (h *Hooks[J, R]) retried(e Event[J, R]) {
+	if h.Retried != nil {
+		h.Retried(e)
+	}
+}
+
+// finished calls Finished or Failed depending on the event error.
+func (h *Hooks[J, R]) finished(e Event[J, R]) {
+	if e.Err == nil && h.Finished != nil {
+		h.Finished(e)
+	}
+
+	if e.Err != nil && h.Failed != nil {
+		h.Failed(e)
+	}
+}
+
+func (h *Hooks[J, R]) breaker(e BreakerEvent) {
+	if h.Breaker != nil {
+		h.Breaker(e)
+	}
+}
+
+func (h *Hooks[J, R]) drained() {
+	if h.Drained != nil {
+		h.Drained()
+	}
+}
@@ -0,0 +1,194 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// trace returns middleware which records calls to log.
+func trace(name string, mu *sync.Mutex, log *[]string) typed.Middleware[int, int] {
+	return func(next typed.ContextProcessor[int, int]) typed.ContextProcessor[int, int] {
+		return typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+			mu.Lock()
+			*log = append(*log, name+" before")
+			mu.Unlock()
+
+			res, retry, err := next.ProcessContext(ctx, j)
+
+			mu.Lock()
+			*log = append(*log, name+" after")
+			mu.Unlock()
+
+			return res, retry, err
+		})
+	}
+}
+
+// cache returns middleware which caches results of successful jobs.
+func cache() typed.Middleware[int, int] {
+	results := sync.Map{}
+
+	return func(next typed.ContextProcessor[int, int]) typed.ContextProcessor[int, int] {
+		return typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+			if res, ok := results.Load(j); ok {
+				return res.(int), false, nil
+			}
+
+			res, retry, err := next.ProcessContext(ctx, j)
+			if err == nil && !retry {
+				results.Store(j, res)
+			}
+
+			return res, retry, err
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		log []string
+	)
+
+	p := typed.Chain[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		mu.Lock()
+		log = append(log, "process")
+		mu.Unlock()
+		return j * 2, false, nil
+	}), trace("outer", &mu, &log), trace("inner", &mu, &log))
+
+	res, retry, err := p.ProcessContext(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.False(t, retry)
+	assert.Equal(t, 4, res)
+
+	assert.Equal(t, []string{"outer before", "inner before", "process", "inner after", "outer after"}, log)
+}
+
+func TestQueue_Use(t *testing.T) {
+	var calls int64
+
+	// Single worker, so every job is cached before its duplicates.
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		atomic.AddInt64(&calls, 1)
+		return j * j, false, nil
+	}), 1, 100)
+
+	q.Use(cache())
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	q.Add(30)
+	for j := 0; j < 30; j++ {
+		q.Schedule(j % 10)
+	}
+	q.Stop()
+
+	sum := 0
+	for o := range outcomes {
+		sum += o.Result
+	}
+
+	assert.Equal(t, 3*285, sum)
+	assert.Equal(t, int64(10), atomic.LoadInt64(&calls))
+}
+
+func TestQueue_SetHooks(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events = make(map[string][]typed.Event[int, int])
+	)
+
+	record := func(name string) func(typed.Event[int, int]) {
+		return func(e typed.Event[int, int]) {
+			mu.Lock()
+			events[name] = append(events[name], e)
+			mu.Unlock()
+		}
+	}
+
+	drained := 0
+
+	// Job 1 fails once and is retried, job 2 fails.
+	q := typed.New[int, int](newProcessor(1, -1), 2, 10)
+	q.SetRetryPolicy(typed.Retry{MaxAttempts: 2, Backoff: typed.Constant(time.Millisecond)})
+	q.SetHooks(typed.Hooks[int, int]{
+		Started:  record("started"),
+		Retried:  record("retried"),
+		Finished: record("finished"),
+		Failed:   record("failed"),
+		Drained: func() {
+			drained++
+		},
+	})
+
+	q.Use(func(next typed.ContextProcessor[int, int]) typed.ContextProcessor[int, int] {
+		return typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+			if j == 2 {
+				return 0, false, errTest
+			}
+			return next.ProcessContext(ctx, j)
+		})
+	})
+
+	collectOutcomes(t, q, 5)
+
+	assert.Len(t, events["started"], 6)
+	assert.Len(t, events["finished"], 4)
+	assert.Equal(t, 1, drained)
+
+	if assert.Len(t, events["retried"], 1) {
+		e := events["retried"][0]
+		assert.Equal(t, 1, e.Job)
+		assert.Equal(t, 1, e.Attempt)
+		assert.Equal(t, time.Millisecond, e.Delay)
+		assert.Equal(t, errTest, e.Err)
+		assert.False(t, e.Start.IsZero())
+	}
+
+	if assert.Len(t, events["failed"], 1) {
+		assert.Equal(t, 2, events["failed"][0].Job)
+	}
+
+	for _, e := range events["finished"] {
+		if e.Job == 1 {
+			assert.Equal(t, 2, e.Attempt)
+			assert.True(t, e.Total >= e.Duration)
+		}
+	}
+}
+
+func TestQueue_SetHooksCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var failed int64
+
+	q := typed.New[int, int](blocking(0), 1, 10)
+	q.SetHooks(typed.Hooks[int, int]{
+		Failed: func(e typed.Event[int, int]) {
+			assert.True(t, errors.Is(e.Err, context.Canceled))
+			atomic.AddInt64(&failed, 1)
+		},
+	})
+
+	q.Start(ctx)
+	q.Add(3)
+	for j := 0; j < 3; j++ {
+		q.Schedule(j)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	waitDone(t, q)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&failed))
+}
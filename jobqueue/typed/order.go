@@ -0,0 +1,85 @@
+package typed
+
+import (
+	"sort"
+	"sync"
+)
+
+// SetOrdered makes the queue emit results and outcomes in order jobs
+// were scheduled. Failed and cancelled jobs keep their place: their
+// outcomes are emitted in order and Next skips them, errors of attempts
+// are sent to Err as soon as they happen. Workers do not start a new job
+// until all the jobs scheduled window or more jobs before it are emitted,
+// so at most window outcomes are buffered. Retries are always started.
+// Window less than 1 is treated as 1. Must be called before Start.
+//
+// Restored jobs are emitted first, see Restore. Jobs rejected after
+// the queue is cancelled are never emitted, so outcomes which wait for
+// them are emitted out of order when the queue is finished.
+func (q *Queue[J, R]) SetOrdered(window int) {
+	if window < 1 {
+		window = 1
+	}
+
+	q.order = &reorder[J, R]{
+		q:   q,
+		buf: make(map[uint64]Outcome[J, R]),
+	}
+
+	q.todo.setWindow(uint64(window))
+}
+
+// reorder is a buffer which emits outcomes by sequence number.
+type reorder[J, R any] struct {
+	q *Queue[J, R]
+
+	mu   sync.Mutex
+	next uint64
+	buf  map[uint64]Outcome[J, R]
+}
+
+// add buffers outcome and emits all the outcomes which are next in order.
+func (r *reorder[J, R]) add(seq uint64, o Outcome[J, R]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf[seq] = o
+
+	next := r.next
+
+	for {
+		o, ok := r.buf[r.next]
+		if !ok {
+			break
+		}
+
+		delete(r.buf, r.next)
+		r.next++
+
+		r.q.send(o)
+	}
+
+	if r.next != next {
+		r.q.todo.advance(r.next)
+	}
+}
+
+// drain emits all the buffered outcomes in order.
+func (r *reorder[J, R]) drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seqs := make([]uint64, 0, len(r.buf))
+	for seq := range r.buf {
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+
+	for _, seq := range seqs {
+		r.q.send(r.buf[seq])
+		delete(r.buf, seq)
+	}
+}
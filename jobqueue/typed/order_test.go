@@ -0,0 +1,147 @@
+package typed_test
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestQueue_SetOrdered(t *testing.T) {
+	const jobs = 200
+
+	retried := sync.Map{}
+
+	// Fails jobs divisible by 13 and retries jobs divisible by 7 once.
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+
+		if j%13 == 0 {
+			return 0, false, errTest
+		}
+
+		if j%7 == 0 {
+			if _, ok := retried.LoadOrStore(j, true); !ok {
+				return 0, true, errTest
+			}
+		}
+
+		return j, false, nil
+	}), 8, 10)
+
+	q.SetOrdered(16)
+	q.Start(context.Background())
+
+	var (
+		results []int
+		errs    int
+	)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		var res int
+		for q.Next(&res) {
+			results = append(results, res)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		var err error
+		for q.Err(&err) {
+			errs++
+		}
+	}()
+
+	q.Add(jobs)
+	for j := 0; j < jobs; j++ {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+	wg.Wait()
+
+	var expected []int
+	for j := 0; j < jobs; j++ {
+		if j%13 != 0 {
+			expected = append(expected, j)
+		}
+	}
+
+	assert.Equal(t, expected, results)
+	// 16 failed jobs and 26 retried ones.
+	assert.Equal(t, 42, errs)
+}
+
+func TestQueue_SetOrderedWindow(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		started []int
+	)
+
+	release := make(chan struct{})
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		mu.Lock()
+		started = append(started, j)
+		mu.Unlock()
+
+		if j == 0 {
+			<-release
+		}
+
+		if j == 2 {
+			return 0, false, errTest
+		}
+
+		return j, false, nil
+	}), 8, 100)
+
+	q.SetOrdered(4)
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	q.Add(20)
+	for j := 0; j < 20; j++ {
+		q.Schedule(j)
+	}
+	q.Stop()
+
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	sort.Ints(started)
+	assert.Equal(t, []int{0, 1, 2, 3}, started)
+	mu.Unlock()
+
+	s := q.Stats()
+	assert.Equal(t, 1, s.InFlight)
+	assert.Equal(t, 16, s.Queued)
+
+	close(release)
+
+	var order []int
+	for o := range outcomes {
+		order = append(order, o.Job)
+
+		if o.Job == 2 {
+			assert.Equal(t, errTest, o.Err)
+		}
+	}
+
+	for j := 0; j < 20; j++ {
+		assert.Equal(t, j, order[j])
+	}
+}
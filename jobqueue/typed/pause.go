@@ -0,0 +1,113 @@
+package typed
+
+import "time"
+
+// State is a state of the queue.
+type State int
+
+const (
+	// StateNew is a state of the queue which is not started yet.
+	StateNew State = iota
+
+	// StateRunning is a state of the queue processing jobs.
+	StateRunning
+
+	// StatePaused is a state of the queue whose workers do not take
+	// new jobs, see Pause.
+	StatePaused
+
+	// StateDraining is a state of the stopped queue which
+	// still processes the remaining jobs, see Stop.
+	StateDraining
+
+	// StateStopped is a state of the finished queue.
+	StateStopped
+)
+
+var stateNames = map[State]string{
+	StateNew:      "new",
+	StateRunning:  "running",
+	StatePaused:   "paused",
+	StateDraining: "draining",
+	StateStopped:  "stopped",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Pause stops workers from taking new jobs, jobs which are already
+// in-flight are processed. Scheduling, retries and cancellation work
+// as usual, time spent in pause is not counted in Speed.
+// Stopped queue drains only after Resume.
+func (q *Queue[J, R]) Pause() {
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+
+	if !q.pausedAt.IsZero() {
+		return
+	}
+
+	q.pausedAt = time.Now()
+	q.todo.pause(true)
+}
+
+// Resume resumes paused queue, see Pause.
+func (q *Queue[J, R]) Resume() {
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+
+	if q.pausedAt.IsZero() {
+		return
+	}
+
+	q.pausedTotal += time.Since(q.pausedAt)
+	q.pausedAt = time.Time{}
+	q.todo.pause(false)
+}
+
+// State returns the current state of the queue.
+func (q *Queue[J, R]) State() State {
+	select {
+	case <-q.finished:
+		return StateStopped
+	default:
+	}
+
+	q.workersMu.Lock()
+	started := q.ctx != nil
+	q.workersMu.Unlock()
+
+	if !started {
+		return StateNew
+	}
+
+	paused, closed := q.todo.state()
+
+	switch {
+	case paused:
+		return StatePaused
+	case closed:
+		return StateDraining
+	}
+
+	return StateRunning
+}
+
+// elapsed returns time since the queue is created without pauses.
+func (q *Queue[J, R]) elapsed() time.Duration {
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+
+	d := time.Since(q.createdAt) - q.pausedTotal
+
+	if !q.pausedAt.IsZero() {
+		d -= time.Since(q.pausedAt)
+	}
+
+	return d
+}
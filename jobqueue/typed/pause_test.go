@@ -0,0 +1,102 @@
+package typed_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestQueue_Pause(t *testing.T) {
+	var processed int64
+
+	release := make(chan struct{})
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j == 0 {
+			<-release
+		}
+		atomic.AddInt64(&processed, 1)
+		return j, false, nil
+	}), 2, 10)
+
+	outcomes := q.Outcomes()
+	assert.Equal(t, typed.StateNew, q.State())
+
+	q.Start(context.Background())
+	assert.Equal(t, typed.StateRunning, q.State())
+
+	q.Add(10)
+	q.Schedule(0)
+
+	// Wait for the job to be in-flight.
+	time.Sleep(10 * time.Millisecond)
+
+	q.Pause()
+	assert.Equal(t, typed.StatePaused, q.State())
+
+	for j := 1; j < 10; j++ {
+		q.Schedule(j)
+	}
+
+	// In-flight job is finished, new ones are not taken.
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&processed))
+
+	speed := q.Speed()
+	time.Sleep(20 * time.Millisecond)
+	assert.InDelta(t, speed, q.Speed(), speed*0.2)
+
+	q.Stop()
+	assert.Equal(t, typed.StatePaused, q.State())
+
+	q.Resume()
+
+	count := 0
+	for range outcomes {
+		count++
+	}
+
+	waitDone(t, q)
+
+	assert.Equal(t, 10, count)
+	assert.Equal(t, float64(1), q.Progress())
+	assert.Equal(t, typed.StateStopped, q.State())
+}
+
+func TestQueue_PauseCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := typed.New[int, int](blocking(-1), 2, 10)
+	outcomes := q.Outcomes()
+
+	q.Pause()
+	q.Start(ctx)
+	q.Add(5)
+
+	for j := 0; j < 5; j++ {
+		q.Schedule(j)
+	}
+
+	cancel()
+
+	count := 0
+	for range outcomes {
+		count++
+	}
+
+	waitDone(t, q)
+
+	assert.Equal(t, 5, count)
+	assert.Len(t, q.Cancelled(), 5)
+}
+
+func TestState_String(t *testing.T) {
+	assert.Equal(t, "draining", typed.StateDraining.String())
+	assert.Equal(t, "unknown", typed.State(100).String())
+}
@@ -0,0 +1,120 @@
+package typed
+
+import "context"
+
+// Pipeline is a set of queues connected with Connect which are started
+// and cancelled together. Back-pressure is propagated through the stages:
+// when a stage is full, connection blocks and outcomes of the previous
+// stage are not consumed, so its workers block as well.
+//
+//	p := typed.NewPipeline()
+//	resolve := typed.AddStage(p, "resolve", typed.New[string, []net.IP](resolver, 10, 100))
+//	probe := typed.AddStage(p, "probe", typed.New[net.IP, Port](prober, 50, 100))
+//	typed.Connect(resolve, probe, func(o typed.Outcome[string, []net.IP]) []net.IP {
+//		return o.Result
+//	})
+//
+//	results := probe.Outcomes()
+//	p.Start(ctx)
+type Pipeline struct {
+	stages []pipelineStage
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type pipelineStage struct {
+	name  string
+	queue interface {
+		Start(context.Context)
+		Stats() Stats
+		Done() <-chan struct{}
+	}
+}
+
+// StageStats is a snapshot of the pipeline stage statistics.
+type StageStats struct {
+	// Name is the stage name.
+	Name string
+
+	Stats
+}
+
+// NewPipeline returns new empty pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{
+		done: make(chan struct{}),
+	}
+}
+
+// AddStage adds queue to the pipeline as a named stage and returns it.
+// Must be called before Start.
+func AddStage[J, R any](p *Pipeline, name string, q *Queue[J, R]) *Queue[J, R] {
+	p.stages = append(p.stages, pipelineStage{name: name, queue: q})
+	return q
+}
+
+// Connect schedules jobs made by fn from every outcome of from to,
+// including failed ones, so fn decides how to handle errors. One outcome
+// can become any number of jobs. When from is finished, to is stopped,
+// so to must have no other inputs. Must be called before from is started,
+// see Queue.Outcomes.
+func Connect[A, B, C, D any](from *Queue[A, B], to *Queue[C, D], fn func(Outcome[A, B]) []C) {
+	outcomes := from.Outcomes()
+
+	go func() {
+		for o := range outcomes {
+			jobs := fn(o)
+
+			to.Add(len(jobs))
+
+			for _, j := range jobs {
+				to.Schedule(j)
+			}
+		}
+
+		to.Stop()
+	}()
+}
+
+// Start starts all the stages with the same context, so cancellation
+// of ctx or Cancel cancels all of them.
+func (p *Pipeline) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	for _, s := range p.stages {
+		s.queue.Start(ctx)
+	}
+
+	go func() {
+		for _, s := range p.stages {
+			<-s.queue.Done()
+		}
+
+		p.cancel()
+		close(p.done)
+	}()
+}
+
+// Cancel cancels all the stages, see Queue.Start.
+func (p *Pipeline) Cancel() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// Done returns channel which is closed when all the stages are finished.
+func (p *Pipeline) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stats returns statistics of all the stages in order they were added.
+func (p *Pipeline) Stats() []StageStats {
+	stats := make([]StageStats, len(p.stages))
+
+	for i, s := range p.stages {
+		stats[i] = StageStats{Name: s.name, Stats: s.queue.Stats()}
+	}
+
+	return stats
+}
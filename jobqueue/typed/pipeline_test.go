@@ -0,0 +1,141 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestPipeline(t *testing.T) {
+	p := typed.NewPipeline()
+
+	// Splits strings into words.
+	split := typed.AddStage(p, "split", typed.New[string, []string](typed.ProcessorFunc[string, []string](func(s string) ([]string, bool, error) {
+		if s == "" {
+			return nil, false, errTest
+		}
+		return strings.Fields(s), false, nil
+	}), 2, 1))
+
+	// Counts word lengths.
+	count := typed.AddStage(p, "count", typed.New[string, int](typed.ProcessorFunc[string, int](func(s string) (int, bool, error) {
+		return len(s), false, nil
+	}), 3, 1))
+
+	var failed []string
+
+	typed.Connect(split, count, func(o typed.Outcome[string, []string]) []string {
+		if o.Err != nil {
+			failed = append(failed, o.Job)
+			return nil
+		}
+		return o.Result
+	})
+
+	outcomes := count.Outcomes()
+	p.Start(context.Background())
+
+	lines := []string{"a bb ccc", "", "dddd", "ee f", ""}
+
+	go func() {
+		split.Add(len(lines))
+		for _, l := range lines {
+			split.Schedule(l)
+		}
+		split.Stop()
+	}()
+
+	total, words := 0, 0
+	for o := range outcomes {
+		total += o.Result
+		words++
+	}
+
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not finished")
+	}
+
+	assert.Equal(t, 13, total)
+	assert.Equal(t, 6, words)
+	assert.Equal(t, []string{"", ""}, failed)
+
+	stats := p.Stats()
+	require.Len(t, stats, 2)
+
+	assert.Equal(t, "split", stats[0].Name)
+	assert.Equal(t, uint64(5), stats[0].Processed)
+	assert.Equal(t, uint64(2), stats[0].Failed)
+	assert.Equal(t, float64(1), stats[0].Progress())
+
+	assert.Equal(t, "count", stats[1].Name)
+	assert.Equal(t, uint64(6), stats[1].Processed)
+	assert.Equal(t, uint64(0), stats[1].Failed)
+	assert.Equal(t, typed.StateStopped, stats[1].State)
+}
+
+func TestPipeline_Cancel(t *testing.T) {
+	p := typed.NewPipeline()
+
+	first := typed.AddStage(p, "first", typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 1))
+	second := typed.AddStage(p, "second", typed.New[int, int](blocking(0), 1, 1))
+
+	typed.Connect(first, second, func(o typed.Outcome[int, int]) []int {
+		if o.Err != nil {
+			return nil
+		}
+		return []int{o.Result}
+	})
+
+	outcomes := second.Outcomes()
+	p.Start(context.Background())
+
+	// Second stage is blocked on the first job, so first stage gets
+	// blocked by back-pressure and does not finish scheduling.
+	scheduled := make(chan struct{})
+
+	go func() {
+		defer close(scheduled)
+
+		first.Add(100)
+		for j := 0; j < 100; j++ {
+			first.Schedule(j)
+		}
+		first.Stop()
+	}()
+
+	select {
+	case <-scheduled:
+		t.Fatal("no back-pressure")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Cancel()
+
+	count := 0
+	for o := range outcomes {
+		count++
+		assert.True(t, errors.Is(o.Err, context.Canceled))
+	}
+
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not finished")
+	}
+
+	<-scheduled
+
+	assert.True(t, count > 0)
+	assert.Equal(t, uint64(0), second.Stats().Processed)
+	assert.NotEmpty(t, first.Cancelled())
+	assert.NotEmpty(t, second.Cancelled())
+}
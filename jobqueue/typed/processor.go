@@ -0,0 +1,39 @@
+package typed
+
+import "context"
+
+// Processor processes jobs of type J into results of type R.
+// Process returns result, true if the job must be retried and an error.
+type Processor[J, R any] interface {
+	Process(J) (R, bool, error)
+}
+
+// ContextProcessor is a Processor which accepts context.
+// If processor implements ContextProcessor, queue calls ProcessContext
+// instead of Process with context which is cancelled when the queue is.
+type ContextProcessor[J, R any] interface {
+	Processor[J, R]
+	ProcessContext(context.Context, J) (R, bool, error)
+}
+
+// ProcessorFunc is an adapter to use ordinary functions as Processor.
+type ProcessorFunc[J, R any] func(J) (R, bool, error)
+
+// Process calls f(j).
+func (f ProcessorFunc[J, R]) Process(j J) (R, bool, error) {
+	return f(j)
+}
+
+// ContextProcessorFunc is an adapter to use ordinary functions
+// as ContextProcessor.
+type ContextProcessorFunc[J, R any] func(context.Context, J) (R, bool, error)
+
+// Process calls f with background context.
+func (f ContextProcessorFunc[J, R]) Process(j J) (R, bool, error) {
+	return f(context.Background(), j)
+}
+
+// ProcessContext calls f(ctx, j).
+func (f ContextProcessorFunc[J, R]) ProcessContext(ctx context.Context, j J) (R, bool, error) {
+	return f(ctx, j)
+}
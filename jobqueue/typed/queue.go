@@ -0,0 +1,595 @@
+// Package typed provides type-safe job queue built on generics.
+package typed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome represents final outcome of a job.
+type Outcome[J, R any] struct {
+	// Job is the original job.
+	Job J
+
+	// Result is the result of the last attempt.
+	Result R
+
+	// Err is the error of the last attempt.
+	Err error
+
+	// Attempts is number of times the job was processed.
+	Attempts int
+
+	// Duration is total processing time of all attempts.
+	Duration time.Duration
+}
+
+// Queue is a job queue which processes jobs of type J
+// into results of type R using a pool of workers.
+type Queue[J, R any] struct {
+	processor Processor[J, R]
+
+	workersMu      sync.Mutex
+	workersWG      sync.WaitGroup
+	workersTarget  int64
+	workersRunning int64
+	workersSpawned int
+	stopped        bool
+
+	jobsWG        sync.WaitGroup
+	jobsCount     uint64
+	jobsProcessed uint64
+
+	// Attempts counters, see Window.
+	attempts uint64
+	failures uint64
+	failed   uint64
+	retries  uint64
+	timeouts uint64
+	panics   uint64
+	busy     int64
+
+	rate rateMeter
+
+	todo     *scheduler[J]
+	groupsMu sync.Mutex
+	groups   map[string]*Group[J, R]
+	done     chan R
+	errs     chan error
+	outcomes chan Outcome[J, R]
+
+	retryPolicy RetryPolicy
+	hooks       Hooks[J, R]
+	order       *reorder[J, R]
+
+	limiter   *limiter
+	rateKey   func(J) string
+	throttled uint64
+
+	dedupKey   func(J) string
+	deduper    Deduper
+	duplicates uint64
+
+	breakerKey func(J) string
+	breakers   *breakers
+	tripped    uint64
+	rejected   uint64
+	timeout    time.Duration
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	finished chan struct{}
+
+	checkpointPath     string
+	checkpointInterval time.Duration
+	checkpointErr      atomic.Pointer[error]
+
+	deadMu sync.Mutex
+	dead   []Outcome[J, R]
+
+	// Pause state, see Pause.
+	pauseMu     sync.Mutex
+	pausedAt    time.Time
+	pausedTotal time.Duration
+
+	createdAt time.Time
+}
+
+// task is a scheduled job with its processing state.
+type task[J any] struct {
+	job      J
+	seq      uint64
+	group    *group[J]
+	priority int
+	attempts int
+	duration time.Duration
+
+	// throttled task has a reserved token of its key rate limit.
+	throttled bool
+
+	// dropped task belongs to cancelled group, see Group.Cancel.
+	dropped bool
+}
+
+// New returns new queue with the given number of workers.
+// Capacity is the size of results and errors buffers and
+// the maximum number of pending jobs in every group, see Group.
+func New[J, R any](processor Processor[J, R], workersCount int, capacity int) *Queue[J, R] {
+	return &Queue[J, R]{
+		processor:     processor,
+		workersTarget: int64(workersCount),
+		todo:          newScheduler[J](capacity),
+		limiter:       newLimiter(),
+		done:          make(chan R, capacity),
+		errs:          make(chan error, capacity),
+		finished:      make(chan struct{}),
+		createdAt:     time.Now(),
+	}
+}
+
+// SetRetryPolicy sets policy for jobs the processor asked to retry
+// because of an error. By default such jobs are retried immediately
+// and infinitely. Jobs the processor asked to retry without an error
+// are not limited by the policy.
+// Must be called before Start.
+func (q *Queue[J, R]) SetRetryPolicy(p RetryPolicy) {
+	q.retryPolicy = p
+}
+
+// DeadLetters returns outcomes of jobs which were not retried anymore
+// because of the retry policy, see SetRetryPolicy.
+func (q *Queue[J, R]) DeadLetters() []Outcome[J, R] {
+	q.deadMu.Lock()
+	defer q.deadMu.Unlock()
+
+	dead := make([]Outcome[J, R], len(q.dead))
+	copy(dead, q.dead)
+
+	return dead
+}
+
+// Add adds delta to the expected number of jobs, see WaitJobs.
+func (q *Queue[J, R]) Add(delta int) {
+	atomic.AddUint64(&q.jobsCount, uint64(delta))
+	q.jobsWG.Add(delta)
+}
+
+// Schedule adds job to the default group of the queue with zero
+// priority, it blocks if the group is full. It panics if the queue is
+// stopped. If the queue is cancelled, the job is not processed and is
+// only reported by Cancelled. Duplicate jobs are skipped, see SetDedup.
+func (q *Queue[J, R]) Schedule(j J) {
+	q.schedule(j)
+}
+
+// SchedulePriority is like Schedule, but jobs with higher priority
+// are processed before jobs with lower priority in any group.
+func (q *Queue[J, R]) SchedulePriority(j J, priority int) {
+	q.scheduleTask(task[J]{job: j, priority: priority})
+}
+
+// schedule schedules job and returns false if the queue is cancelled.
+func (q *Queue[J, R]) schedule(j J) bool {
+	return q.scheduleTask(task[J]{job: j})
+}
+
+// scheduleTask schedules task and returns false if the queue
+// or the task group is cancelled.
+func (q *Queue[J, R]) scheduleTask(t task[J]) bool {
+	if q.duplicate(t) {
+		return true
+	}
+
+	switch q.todo.push(&t) {
+	case pushAborted:
+		q.jobsWG.Done()
+		return false
+	case pushCancelled:
+		q.cancelTask(t)
+		return false
+	}
+
+	return true
+}
+
+// Outcomes returns stream of jobs outcomes, there is exactly one outcome
+// for every job, including failed ones. It is the recommended way to
+// consume results: unlike Next and Err it is a single stream, so there is
+// no need to drain two channels concurrently to avoid workers deadlock.
+//
+// Outcomes must be called before Start. Once it is called, results and
+// errors are not sent to Next and Err anymore. The stream is closed when
+// all the workers are finished.
+func (q *Queue[J, R]) Outcomes() <-chan Outcome[J, R] {
+	if q.outcomes == nil {
+		q.outcomes = make(chan Outcome[J, R], cap(q.done))
+	}
+
+	return q.outcomes
+}
+
+// Next waits for the next result and stores it in dest.
+// It returns false when all the workers are finished.
+// Next and Err must be consumed concurrently, see Outcomes.
+func (q *Queue[J, R]) Next(dest *R) bool {
+	res, ok := <-q.done
+	if !ok {
+		return false
+	}
+
+	*dest = res
+
+	return true
+}
+
+// Err waits for the next error and stores it in e.
+// It returns false when all the workers are finished.
+func (q *Queue[J, R]) Err(e *error) bool {
+	err, ok := <-q.errs
+	if !ok {
+		return false
+	}
+
+	*e = err
+
+	return true
+}
+
+// Start starts workers. When ctx is cancelled workers stop taking jobs,
+// context-aware processors get cancelled context and all the jobs which
+// were not processed yet are cancelled: they get outcome with the context
+// error and are available via Cancelled. Outputs are closed when all
+// the workers are finished.
+func (q *Queue[J, R]) Start(ctx context.Context) {
+	q.workersMu.Lock()
+
+	q.ctx, q.cancel = context.WithCancel(ctx)
+
+	for i := int64(0); i < q.workersTarget; i++ {
+		q.spawn()
+	}
+
+	q.workersMu.Unlock()
+
+	go func() {
+		select {
+		case <-q.ctx.Done():
+		case <-q.todo.spillFailed:
+			q.cancel()
+		case <-q.finished:
+			return
+		}
+
+		q.todo.abort()
+	}()
+
+	if q.checkpointPath != "" && q.checkpointInterval > 0 {
+		go q.checkpointer()
+	}
+
+	go func() {
+		q.workersWG.Wait()
+
+		q.workersMu.Lock()
+		q.stopped = true
+		q.workersMu.Unlock()
+
+		q.flush()
+		q.cancel()
+
+		if q.checkpointPath != "" {
+			q.saveCheckpoint()
+		}
+
+		q.todo.cleanSpill()
+
+		close(q.done)
+		close(q.errs)
+
+		if q.outcomes != nil {
+			close(q.outcomes)
+		}
+
+		close(q.finished)
+	}()
+}
+
+// Stop tells workers to finish after all the scheduled jobs are processed.
+func (q *Queue[J, R]) Stop() {
+	q.todo.close()
+}
+
+// Shutdown stops the queue and waits for all the scheduled and in-flight
+// jobs to be processed. If ctx is done first, the queue is cancelled and
+// ctx error is returned without waiting for in-flight jobs.
+func (q *Queue[J, R]) Shutdown(ctx context.Context) error {
+	q.Stop()
+
+	select {
+	case <-q.finished:
+		return nil
+	case <-ctx.Done():
+		if q.cancel != nil {
+			q.cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// Done returns channel which is closed when the queue is finished
+// and all the outputs are closed.
+func (q *Queue[J, R]) Done() <-chan struct{} {
+	return q.finished
+}
+
+// Cancelled returns jobs which were not processed because
+// the queue was cancelled.
+func (q *Queue[J, R]) Cancelled() []J {
+	return q.todo.cancelledJobs()
+}
+
+// WaitWorkers waits for all the workers to finish.
+func (q *Queue[J, R]) WaitWorkers() {
+	q.workersWG.Wait()
+}
+
+// WaitJobs waits for all the added jobs to be processed.
+func (q *Queue[J, R]) WaitJobs() {
+	q.jobsWG.Wait()
+}
+
+// Progress returns ratio of processed jobs to added jobs,
+// it is zero if no jobs are added.
+func (q *Queue[J, R]) Progress() float64 {
+	count := atomic.LoadUint64(&q.jobsCount)
+	if count == 0 {
+		return 0
+	}
+
+	return float64(atomic.LoadUint64(&q.jobsProcessed)) / float64(count)
+}
+
+// Speed returns number of processed jobs per second, see Stats.Rate.
+func (q *Queue[J, R]) Speed() float64 {
+	return q.Stats().Rate
+}
+
+func (q *Queue[J, R]) worker(id int) {
+	defer q.workersWG.Done()
+
+	// Retired worker is already not counted as running.
+	retired := false
+
+	retire := func() bool {
+		retired = q.retire()
+		return retired
+	}
+
+	for {
+		// Do not wait for the watcher to abort scheduler,
+		// so no jobs are taken after cancellation.
+		if q.ctx.Err() != nil {
+			q.todo.abort()
+		}
+
+		t, ok := q.todo.take(retire)
+		if !ok {
+			if !retired {
+				// Scheduler is finished or aborted, so no workers
+				// must be spawned after this one is done.
+				q.workersMu.Lock()
+				q.stopped = true
+				atomic.AddInt64(&q.workersRunning, -1)
+				q.workersMu.Unlock()
+			}
+			return
+		}
+
+		if t.dropped {
+			q.cancelTask(t)
+			continue
+		}
+
+		if q.throttle(&t) && q.admit(t) {
+			q.process(t)
+		}
+
+		q.todo.done(t)
+	}
+}
+
+func (q *Queue[J, R]) process(t task[J]) {
+	start := time.Now()
+
+	q.hooks.started(Event[J, R]{
+		Job:     t.job,
+		Attempt: t.attempts + 1,
+		Start:   start,
+		Total:   t.duration,
+	})
+
+	ctx, cancel := q.jobContext(t)
+	res, retry, err := q.invoke(ctx, t.job)
+
+	// The job is interrupted by the queue or group cancellation,
+	// so it is cancelled rather than failed.
+	interrupted := err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err())
+	cancel()
+
+	q.trip(t, err, interrupted)
+
+	elapsed := time.Since(start)
+
+	t.attempts++
+	t.duration += elapsed
+
+	if interrupted {
+		if q.ctx.Err() != nil {
+			q.todo.abort()
+		}
+
+		if !q.todo.retry(t, 0) {
+			q.cancelTask(t)
+		}
+
+		return
+	}
+
+	atomic.AddUint64(&q.attempts, 1)
+	atomic.AddInt64(&q.busy, int64(elapsed))
+
+	e := Event[J, R]{
+		Job:      t.job,
+		Result:   res,
+		Err:      err,
+		Attempt:  t.attempts,
+		Start:    start,
+		Duration: elapsed,
+		Total:    t.duration,
+	}
+
+	if err != nil {
+		atomic.AddUint64(&q.failures, 1)
+		atomic.AddUint64(&t.group.errors, 1)
+	}
+
+	if err != nil && q.outcomes == nil {
+		q.errs <- err
+	}
+
+	dead := false
+
+	if retry {
+		delay, ok := time.Duration(0), true
+
+		if err != nil && q.retryPolicy != nil {
+			delay, ok = q.retryPolicy.Retry(t.attempts, err)
+		}
+
+		if ok {
+			if d, set := retryDelay(err); set {
+				delay = d
+			}
+
+			atomic.AddUint64(&q.retries, 1)
+
+			e.Delay = delay
+			q.hooks.retried(e)
+
+			if !q.todo.retry(t, delay) {
+				q.cancelTask(t)
+			}
+
+			return
+		}
+
+		dead = true
+	}
+
+	q.jobsWG.Done()
+	atomic.AddUint64(&q.jobsProcessed, 1)
+	atomic.AddUint64(&t.group.processed, 1)
+
+	if err != nil {
+		atomic.AddUint64(&q.failed, 1)
+	}
+
+	o := Outcome[J, R]{
+		Job:      t.job,
+		Result:   res,
+		Err:      err,
+		Attempts: t.attempts,
+		Duration: t.duration,
+	}
+
+	if dead {
+		q.deadMu.Lock()
+		q.dead = append(q.dead, o)
+		q.deadMu.Unlock()
+	}
+
+	q.hooks.finished(e)
+
+	q.deliver(t.seq, o)
+}
+
+// deliver sends outcome of the task with the given sequence number
+// to outcomes or, if it is successful, its result to results.
+func (q *Queue[J, R]) deliver(seq uint64, o Outcome[J, R]) {
+	if q.order != nil {
+		q.order.add(seq, o)
+		return
+	}
+
+	q.send(o)
+}
+
+func (q *Queue[J, R]) send(o Outcome[J, R]) {
+	if q.outcomes != nil {
+		q.outcomes <- o
+		return
+	}
+
+	if o.Err != nil {
+		return
+	}
+
+	q.done <- o.Result
+}
+
+// flush reports cancelled tasks.
+func (q *Queue[J, R]) flush() {
+	q.todo.waitSpill()
+
+	for _, t := range q.todo.cancelledTasks() {
+		q.jobsWG.Done()
+
+		q.hooks.finished(Event[J, R]{
+			Job:     t.job,
+			Err:     q.ctx.Err(),
+			Attempt: t.attempts,
+			Total:   t.duration,
+		})
+
+		q.deliver(t.seq, Outcome[J, R]{
+			Job:      t.job,
+			Err:      q.ctx.Err(),
+			Attempts: t.attempts,
+			Duration: t.duration,
+		})
+	}
+
+	for _, t := range q.todo.droppedTasks() {
+		q.cancelTask(t)
+	}
+
+	if q.order != nil {
+		q.order.drain()
+	}
+
+	// Spilled jobs which could not be read back are unknown,
+	// so their outcomes have zero jobs, see SpillErr.
+	for g, n := range q.todo.lostTasks() {
+		err := fmt.Errorf("%w: %v", ErrSpillLost, q.SpillErr())
+
+		for ; n > 0; n-- {
+			q.jobsWG.Done()
+			atomic.AddUint64(&q.jobsProcessed, 1)
+			atomic.AddUint64(&g.processed, 1)
+			atomic.AddUint64(&q.failed, 1)
+
+			if q.outcomes == nil {
+				q.errs <- err
+			}
+
+			q.hooks.finished(Event[J, R]{Err: err})
+			q.send(Outcome[J, R]{Err: err})
+		}
+	}
+
+	q.hooks.drained()
+}
@@ -0,0 +1,233 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+var errTest = errors.New("test")
+
+// processor squares job numbers, it fails once on errID
+// and asks to retry once on retryID.
+type processor struct {
+	mu      sync.Mutex
+	errID   int
+	retryID int
+	calls   map[int]int
+}
+
+func newProcessor(errID, retryID int) *processor {
+	return &processor{
+		errID:   errID,
+		retryID: retryID,
+		calls:   make(map[int]int),
+	}
+}
+
+func (p *processor) Process(j int) (int, bool, error) {
+	p.mu.Lock()
+	p.calls[j]++
+	calls := p.calls[j]
+	p.mu.Unlock()
+
+	if j == p.errID && calls == 1 {
+		return 0, true, errTest
+	}
+
+	if j == p.retryID && calls == 1 {
+		return 0, true, nil
+	}
+
+	return j * j, false, nil
+}
+
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		jobs    int
+		workers int
+		errID   int
+		retryID int
+	}{
+		{jobs: 10, workers: 3, errID: 5, retryID: 6},
+		{jobs: 10, workers: 3, errID: 6, retryID: 6},
+		{jobs: 100, workers: 5, errID: 5, retryID: 50},
+		{jobs: 100, workers: 50, errID: 50, retryID: 80},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			proc := newProcessor(tt.errID, tt.retryID)
+
+			q := typed.New[int, int](proc, tt.workers, tt.jobs)
+			q.Start(context.Background())
+
+			var (
+				sum   int
+				count int
+				errs  []error
+			)
+
+			wg := sync.WaitGroup{}
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				var res int
+				for q.Next(&res) {
+					sum += res
+					count++
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				var err error
+				for q.Err(&err) {
+					errs = append(errs, err)
+				}
+			}()
+
+			q.Add(tt.jobs)
+
+			expected := 0
+			for j := 0; j < tt.jobs; j++ {
+				q.Schedule(j)
+				expected += j * j
+			}
+
+			q.WaitJobs()
+			assert.Equal(t, float64(1), q.Progress())
+
+			q.Stop()
+			q.WaitWorkers()
+			wg.Wait()
+
+			assert.Equal(t, tt.jobs, count)
+			assert.Equal(t, expected, sum)
+			assert.Equal(t, []error{errTest}, errs)
+		})
+	}
+}
+
+func TestProcessorFunc(t *testing.T) {
+	q := typed.New[string, int](typed.ProcessorFunc[string, int](func(s string) (int, bool, error) {
+		return len(s), false, nil
+	}), 2, 3)
+
+	q.Start(context.Background())
+	q.Add(3)
+
+	for _, s := range []string{"a", "bb", "ccc"} {
+		q.Schedule(s)
+	}
+
+	q.WaitJobs()
+	q.Stop()
+
+	sum := 0
+
+	var n int
+	for q.Next(&n) {
+		sum += n
+	}
+
+	var err error
+	assert.False(t, q.Err(&err))
+	assert.Equal(t, 6, sum)
+}
+
+func TestQueue_Outcomes(t *testing.T) {
+	const jobs = 100
+
+	// Fails on odd jobs and asks to retry every job divisible by 10 once.
+	retried := sync.Map{}
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j%10 == 0 {
+			if _, ok := retried.LoadOrStore(j, true); !ok {
+				return 0, true, errTest
+			}
+		}
+
+		if j%2 == 1 {
+			return 0, false, errTest
+		}
+
+		return j, false, nil
+	}), 4, 1)
+
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		q.Add(jobs)
+
+		for j := 0; j < jobs; j++ {
+			q.Schedule(j)
+		}
+
+		q.WaitJobs()
+		q.Stop()
+	}()
+
+	count, failed := 0, 0
+
+	// With capacity 1 the queue would deadlock here if errors were sent
+	// to the errors channel which nobody reads.
+	timeout := time.After(5 * time.Second)
+
+loop:
+	for {
+		select {
+		case o, ok := <-outcomes:
+			if !ok {
+				break loop
+			}
+
+			count++
+
+			if o.Err != nil {
+				failed++
+				assert.Equal(t, 1, o.Job%2)
+				continue
+			}
+
+			assert.Equal(t, o.Job, o.Result)
+
+			if o.Job%10 == 0 {
+				assert.Equal(t, 2, o.Attempts)
+			} else {
+				assert.Equal(t, 1, o.Attempts)
+			}
+
+		case <-timeout:
+			t.Fatal("deadlock")
+		}
+	}
+
+	<-done
+
+	assert.Equal(t, jobs, count)
+	assert.Equal(t, jobs/2, failed)
+
+	var res int
+	assert.False(t, q.Next(&res))
+
+	var err error
+	assert.False(t, q.Err(&err))
+}
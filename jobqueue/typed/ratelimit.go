@@ -0,0 +1,256 @@
+package typed
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limit is a token bucket rate limit.
+type Limit struct {
+	// Rate is the number of jobs per second, zero means no limit.
+	Rate float64
+
+	// Burst is the number of jobs which can be started at once
+	// after idle time. Values less than 1 are treated as 1.
+	Burst int
+}
+
+// burst returns bucket size.
+func (l Limit) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+
+	return float64(l.Burst)
+}
+
+// bucket is a token bucket state.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(l Limit, now time.Time) *bucket {
+	return &bucket{tokens: l.burst(), last: now}
+}
+
+// refill adds tokens for the time passed since the last refill.
+func (b *bucket) refill(l Limit, now time.Time) {
+	if l.Rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	}
+
+	if burst := l.burst(); b.tokens > burst {
+		b.tokens = burst
+	}
+
+	b.last = now
+}
+
+// take reserves a token and returns time to wait for it.
+func (b *bucket) take(l Limit, now time.Time) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+
+	b.refill(l, now)
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / l.Rate * float64(time.Second))
+}
+
+// minSweep is the number of key buckets after which
+// the full ones are removed.
+const minSweep = 1024
+
+// limiter is a global and per-key rate limiter.
+type limiter struct {
+	mu sync.Mutex
+
+	limit  Limit
+	global *bucket
+
+	keyLimit  Limit
+	keyLimits map[string]Limit
+	keys      map[string]*bucket
+	sweepAt   int
+}
+
+func newLimiter() *limiter {
+	now := time.Now()
+
+	return &limiter{
+		global:    newBucket(Limit{}, now),
+		keyLimits: make(map[string]Limit),
+		keys:      make(map[string]*bucket),
+		sweepAt:   minSweep,
+	}
+}
+
+func (l *limiter) setLimit(limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// Tokens collected with the old limit are kept.
+	l.global.refill(l.limit, now)
+	l.limit = limit
+	l.global.refill(limit, now)
+}
+
+func (l *limiter) setKeyLimit(key string, limit Limit, all bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// Tokens collected with the old limits are kept.
+	for k, b := range l.keys {
+		b.refill(l.limitFor(k), now)
+	}
+
+	if all {
+		l.keyLimit = limit
+	} else {
+		l.keyLimits[key] = limit
+	}
+
+	for k, b := range l.keys {
+		b.refill(l.limitFor(k), now)
+	}
+}
+
+func (l *limiter) limits() (Limit, Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit, l.keyLimit
+}
+
+// takeGlobal reserves a global token and returns time to wait for it.
+func (l *limiter) takeGlobal(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.global.take(l.limit, now)
+}
+
+// takeKey reserves a token of the key and returns time to wait for it.
+func (l *limiter) takeKey(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limitFor(key)
+	if limit.Rate <= 0 {
+		return 0
+	}
+
+	b, ok := l.keys[key]
+	if !ok {
+		if len(l.keys) >= l.sweepAt {
+			l.sweep(now)
+		}
+
+		b = newBucket(limit, now)
+		l.keys[key] = b
+	}
+
+	return b.take(limit, now)
+}
+
+func (l *limiter) limitFor(key string) Limit {
+	if limit, ok := l.keyLimits[key]; ok {
+		return limit
+	}
+
+	return l.keyLimit
+}
+
+// sweep removes full buckets, they are the same as new ones.
+func (l *limiter) sweep(now time.Time) {
+	for k, b := range l.keys {
+		limit := l.limitFor(k)
+		b.refill(limit, now)
+
+		if b.tokens >= limit.burst() {
+			delete(l.keys, k)
+		}
+	}
+
+	l.sweepAt = 2 * len(l.keys)
+
+	if l.sweepAt < minSweep {
+		l.sweepAt = minSweep
+	}
+}
+
+// SetRateLimit sets global limit of jobs started per second.
+// It may be called on a running queue.
+func (q *Queue[J, R]) SetRateLimit(l Limit) {
+	q.limiter.setLimit(l)
+}
+
+// SetRateKey sets function which returns key of the job for per-key
+// rate limits, e.g. target host. Must be called before Start.
+func (q *Queue[J, R]) SetRateKey(fn func(J) string) {
+	q.rateKey = fn
+}
+
+// SetKeyRateLimit sets rate limit of every key which has no own limit,
+// see SetRateKey. It may be called on a running queue.
+func (q *Queue[J, R]) SetKeyRateLimit(l Limit) {
+	q.limiter.setKeyLimit("", l, true)
+}
+
+// SetKeyRateLimitFor sets rate limit of the given key,
+// see SetRateKey. It may be called on a running queue.
+func (q *Queue[J, R]) SetKeyRateLimitFor(key string, l Limit) {
+	q.limiter.setKeyLimit(key, l, false)
+}
+
+// throttle waits for rate limits of the taken task. It returns false if
+// the task must not be processed now: it is delayed because of its key
+// limit, so the worker can take another task, or the queue is cancelled.
+func (q *Queue[J, R]) throttle(t *task[J]) bool {
+	if q.rateKey != nil && !t.throttled {
+		if d := q.limiter.takeKey(q.rateKey(t.job), time.Now()); d > 0 {
+			atomic.AddUint64(&q.throttled, 1)
+
+			// Token is already reserved for the task.
+			t.throttled = true
+
+			if !q.todo.retry(*t, d) {
+				q.cancelTask(*t)
+			}
+
+			return false
+		}
+	}
+
+	t.throttled = false
+
+	d := q.limiter.takeGlobal(time.Now())
+	if d <= 0 {
+		return true
+	}
+
+	atomic.AddUint64(&q.throttled, 1)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-q.ctx.Done():
+		q.todo.abort()
+		q.todo.retry(*t, 0)
+		return false
+	}
+}
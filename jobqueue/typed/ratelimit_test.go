@@ -0,0 +1,133 @@
+package typed_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// timestamps returns processor which records start time of every job.
+func timestamps() (typed.ProcessorFunc[int, int], func() []time.Time) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+
+	p := func(j int) (int, bool, error) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		return j, false, nil
+	}
+
+	get := func() []time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), times...)
+	}
+
+	return p, get
+}
+
+func runJobs(t *testing.T, q *typed.Queue[int, int], jobs []int) {
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	q.Add(len(jobs))
+	for _, j := range jobs {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+
+	for range outcomes {
+	}
+
+	waitDone(t, q)
+}
+
+func TestQueue_SetRateLimit(t *testing.T) {
+	proc, times := timestamps()
+
+	q := typed.New[int, int](proc, 4, 100)
+	q.SetRateLimit(typed.Limit{Rate: 100, Burst: 5})
+
+	start := time.Now()
+	runJobs(t, q, make([]int, 25))
+
+	// 5 jobs at once and 20 more at 100 per second.
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 190*time.Millisecond, elapsed)
+	assert.True(t, elapsed < time.Second, elapsed)
+	assert.Len(t, times(), 25)
+
+	s := q.Stats()
+	assert.Equal(t, typed.Limit{Rate: 100, Burst: 5}, s.RateLimit)
+	assert.True(t, s.Throttled >= 20)
+}
+
+func TestQueue_SetKeyRateLimit(t *testing.T) {
+	proc, _ := timestamps()
+
+	q := typed.New[int, int](proc, 2, 100)
+	q.SetRateKey(func(j int) string {
+		if j < 10 {
+			return "slow"
+		}
+		return "fast"
+	})
+	q.SetKeyRateLimit(typed.Limit{Rate: 1000, Burst: 100})
+	q.SetKeyRateLimitFor("slow", typed.Limit{Rate: 50, Burst: 1})
+
+	jobs := make([]int, 0, 110)
+	for j := 0; j < 110; j++ {
+		jobs = append(jobs, j)
+	}
+
+	done := make(map[int]time.Duration)
+	start := time.Now()
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	q.Add(len(jobs))
+	for _, j := range jobs {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+
+	for o := range outcomes {
+		done[o.Job] = time.Since(start)
+	}
+
+	waitDone(t, q)
+
+	// Slow key does not block fast one.
+	assert.True(t, done[109] < 100*time.Millisecond, done[109])
+	assert.True(t, done[9] >= 170*time.Millisecond, done[9])
+	assert.Equal(t, typed.Limit{Rate: 1000, Burst: 100}, q.Stats().KeyRateLimit)
+}
+
+func TestQueue_SetRateLimitRuntime(t *testing.T) {
+	proc, times := timestamps()
+
+	q := typed.New[int, int](proc, 1, 100)
+	q.SetRateLimit(typed.Limit{Rate: 1})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q.SetRateLimit(typed.Limit{})
+	}()
+
+	start := time.Now()
+	runJobs(t, q, make([]int, 10))
+
+	assert.Len(t, times(), 10)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
@@ -0,0 +1,655 @@
+package typed
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWorkerLost is an error of the job whose remote worker
+	// disconnected or stopped sending heartbeats, such jobs are retried.
+	ErrWorkerLost = errors.New("remote worker lost")
+
+	// ErrCoordinatorClosed is an error of the job processed
+	// by the closed coordinator.
+	ErrCoordinatorClosed = errors.New("coordinator closed")
+)
+
+// RemoteError is an error returned by processor of a remote worker.
+type RemoteError struct {
+	// Addr is the remote worker address.
+	Addr string
+
+	// Msg is the error message.
+	Msg string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote worker %s: %s", e.Addr, e.Msg)
+}
+
+// Protocol messages types.
+const (
+	msgHello  = "hello"
+	msgPing   = "ping"
+	msgJob    = "job"
+	msgCancel = "cancel"
+	msgResult = "result"
+
+	// msgLost is not sent, it tells the waiting call
+	// that its worker is lost.
+	msgLost = "lost"
+)
+
+// maxMessageSize limits size of a protocol message.
+const maxMessageSize = 64 << 20
+
+// message is a protocol message, it is sent as big-endian uint32
+// length followed by JSON.
+type message struct {
+	Type   string          `json:"type"`
+	ID     uint64          `json:"id,omitempty"`
+	Slots  int             `json:"slots,omitempty"`
+	Job    json.RawMessage `json:"job,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Retry  bool            `json:"retry,omitempty"`
+	Err    string          `json:"err,omitempty"`
+}
+
+func writeMessage(w io.Writer, m message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	copy(buf[4:], b)
+
+	_, err = w.Write(buf)
+
+	return err
+}
+
+func readMessage(r io.Reader) (message, error) {
+	var m message
+
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return m, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxMessageSize {
+		return m, fmt.Errorf("message is too big: %d", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+// DefaultHeartbeat is the default interval of worker heartbeats.
+const DefaultHeartbeat = time.Second
+
+// Coordinator is a processor which hands jobs out to remote workers
+// connected over TCP or Unix socket, see Worker. It is used as processor
+// of the coordinator queue, so results are consumed as usual with Next,
+// Err or Outcomes. Jobs and results must be serializable with
+// encoding/json. Number of coordinator queue workers limits the number
+// of jobs handed out at once, so it should be at least the total number
+// of remote worker slots.
+//
+// Jobs of the worker which disconnects or does not send heartbeats for
+// the timeout fail with ErrWorkerLost and are retried, so they are
+// subject to the queue retry policy, see SetRetryPolicy.
+type Coordinator[J, R any] struct {
+	timeout time.Duration
+
+	mu        sync.Mutex
+	remotes   map[*remote]struct{}
+	listeners []net.Listener
+	closed    bool
+	seq       uint64
+
+	// rejected is the number of results which match no call.
+	rejected int
+
+	// changed is closed and replaced when slots are freed
+	// or workers are connected.
+	changed chan struct{}
+}
+
+// remote is a connected worker.
+type remote struct {
+	conn net.Conn
+	addr string
+
+	wmu sync.Mutex
+
+	// Guarded by coordinator mutex. Abandoned calls keep
+	// their slots busy until the worker replies.
+	slots     int
+	busy      int
+	calls     map[uint64]chan message
+	abandoned map[uint64]struct{}
+	lost      bool
+}
+
+func (r *remote) send(m message) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+
+	return writeMessage(r.conn, m)
+}
+
+var _ ContextProcessor[int, int] = &Coordinator[int, int]{}
+
+// NewCoordinator returns new coordinator without workers.
+func NewCoordinator[J, R any]() *Coordinator[J, R] {
+	return &Coordinator[J, R]{
+		timeout: 5 * DefaultHeartbeat,
+		remotes: make(map[*remote]struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// SetTimeout sets time without messages after which worker is considered
+// lost, it must be greater than workers heartbeat interval.
+// Must be called before Serve.
+func (c *Coordinator[J, R]) SetTimeout(d time.Duration) {
+	c.timeout = d
+}
+
+// Serve accepts workers connections until the listener or
+// the coordinator is closed.
+func (c *Coordinator[J, R]) Serve(ln net.Listener) error {
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+		ln.Close()
+		return ErrCoordinatorClosed
+	}
+
+	c.listeners = append(c.listeners, ln)
+	c.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			c.mu.Lock()
+			closed := c.closed
+			c.mu.Unlock()
+
+			if closed {
+				return nil
+			}
+
+			return err
+		}
+
+		go c.handle(conn)
+	}
+}
+
+// Close closes all the listeners and workers connections.
+func (c *Coordinator[J, R]) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	var err error
+
+	for _, ln := range c.listeners {
+		if e := ln.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	for r := range c.remotes {
+		r.conn.Close()
+	}
+
+	c.broadcast()
+
+	return err
+}
+
+// Workers returns number of connected workers and their total slots.
+func (c *Coordinator[J, R]) Workers() (workers int, slots int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for r := range c.remotes {
+		slots += r.slots
+	}
+
+	return len(c.remotes), slots
+}
+
+// ProtocolErrors returns number of results rejected because they
+// do not match any job handed out to the worker, e.g. duplicates.
+func (c *Coordinator[J, R]) ProtocolErrors() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rejected
+}
+
+// Process calls ProcessContext with background context.
+func (c *Coordinator[J, R]) Process(j J) (R, bool, error) {
+	return c.ProcessContext(context.Background(), j)
+}
+
+// ProcessContext hands job out to a worker with free slot
+// and waits for its result.
+func (c *Coordinator[J, R]) ProcessContext(ctx context.Context, j J) (R, bool, error) {
+	var res R
+
+	job, err := json.Marshal(j)
+	if err != nil {
+		return res, false, err
+	}
+
+	r, id, ch, err := c.lease(ctx)
+	if err != nil {
+		return res, false, err
+	}
+
+	if err := r.send(message{Type: msgJob, ID: id, Job: job}); err != nil {
+		c.lose(r)
+	}
+
+	select {
+	case m := <-ch:
+		if m.Type == msgLost {
+			return res, true, ErrWorkerLost
+		}
+
+		if m.Err != "" {
+			err = &RemoteError{Addr: r.addr, Msg: m.Err}
+		}
+
+		if len(m.Result) > 0 {
+			if e := json.Unmarshal(m.Result, &res); e != nil && err == nil {
+				err = e
+			}
+		}
+
+		return res, m.Retry, err
+
+	case <-ctx.Done():
+		c.abandon(r, id)
+		return res, false, ctx.Err()
+	}
+}
+
+// lease waits for a worker with free slot and registers call on it.
+func (c *Coordinator[J, R]) lease(ctx context.Context) (*remote, uint64, chan message, error) {
+	for {
+		c.mu.Lock()
+
+		if c.closed {
+			c.mu.Unlock()
+			return nil, 0, nil, ErrCoordinatorClosed
+		}
+
+		// The least busy worker.
+		var best *remote
+
+		for r := range c.remotes {
+			if r.busy >= r.slots {
+				continue
+			}
+
+			if best == nil || r.slots-r.busy > best.slots-best.busy {
+				best = r
+			}
+		}
+
+		if best != nil {
+			id := c.seq
+			c.seq++
+
+			ch := make(chan message, 1)
+			best.calls[id] = ch
+			best.busy++
+
+			c.mu.Unlock()
+
+			return best, id, ch, nil
+		}
+
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, 0, nil, ctx.Err()
+		}
+	}
+}
+
+// abandon forgets call cancelled by the caller and tells worker to cancel
+// it, the slot is freed when the worker replies.
+func (c *Coordinator[J, R]) abandon(r *remote, id uint64) {
+	c.mu.Lock()
+	_, ok := r.calls[id]
+	if ok {
+		delete(r.calls, id)
+		r.abandoned[id] = struct{}{}
+	}
+	c.mu.Unlock()
+
+	if ok {
+		r.send(message{Type: msgCancel, ID: id})
+	}
+}
+
+// handle registers worker and reads its messages until it is lost.
+func (c *Coordinator[J, R]) handle(conn net.Conn) {
+	r := &remote{
+		conn:      conn,
+		addr:      conn.RemoteAddr().String(),
+		calls:     make(map[uint64]chan message),
+		abandoned: make(map[uint64]struct{}),
+	}
+
+	br := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(c.timeout))
+
+	m, err := readMessage(br)
+	if err != nil || m.Type != msgHello || m.Slots < 1 {
+		conn.Close()
+		return
+	}
+
+	r.slots = m.Slots
+
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+
+	c.remotes[r] = struct{}{}
+	c.broadcast()
+	c.mu.Unlock()
+
+	defer c.lose(r)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.timeout))
+
+		m, err := readMessage(br)
+		if err != nil {
+			return
+		}
+
+		if m.Type != msgResult {
+			continue
+		}
+
+		c.mu.Lock()
+
+		ch, ok := r.calls[m.ID]
+		_, abandoned := r.abandoned[m.ID]
+
+		switch {
+		case ok:
+			delete(r.calls, m.ID)
+		case abandoned:
+			delete(r.abandoned, m.ID)
+		default:
+			// Stray or duplicate result does not free a slot,
+			// so the worker does not get more jobs than its slots.
+			c.rejected++
+			c.mu.Unlock()
+			continue
+		}
+
+		r.busy--
+		c.broadcast()
+
+		c.mu.Unlock()
+
+		if ok {
+			ch <- m
+		}
+	}
+}
+
+// lose removes worker and fails all its calls with ErrWorkerLost.
+func (c *Coordinator[J, R]) lose(r *remote) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r.lost {
+		return
+	}
+
+	r.lost = true
+	r.conn.Close()
+
+	delete(c.remotes, r)
+
+	for id, ch := range r.calls {
+		ch <- message{Type: msgLost}
+		delete(r.calls, id)
+	}
+
+	c.broadcast()
+}
+
+// broadcast wakes up calls waiting for free slots, mu must be held.
+func (c *Coordinator[J, R]) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Worker processes jobs of a remote coordinator, see Coordinator.
+type Worker[J, R any] struct {
+	processor Processor[J, R]
+	slots     int
+	heartbeat time.Duration
+}
+
+// NewWorker returns new worker which processes up to slots jobs at once.
+func NewWorker[J, R any](processor Processor[J, R], slots int) *Worker[J, R] {
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &Worker[J, R]{
+		processor: processor,
+		slots:     slots,
+		heartbeat: DefaultHeartbeat,
+	}
+}
+
+// SetHeartbeat sets interval of heartbeats, it must be less than
+// the coordinator timeout. Must be called before Serve.
+func (w *Worker[J, R]) SetHeartbeat(d time.Duration) {
+	w.heartbeat = d
+}
+
+// Serve processes jobs received over the connection to the coordinator
+// until the connection is closed or ctx is done, in-flight jobs get
+// cancelled context. It returns nil when the coordinator closes
+// the connection.
+func (w *Worker[J, R]) Serve(ctx context.Context, conn net.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wmu sync.Mutex
+
+	send := func(m message) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+
+		return writeMessage(conn, m)
+	}
+
+	if err := send(message{Type: msgHello, Slots: w.slots}); err != nil {
+		conn.Close()
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(w.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if send(message{Type: msgPing}) != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu   sync.Mutex
+		jobs = make(map[uint64]context.CancelFunc)
+		wg   sync.WaitGroup
+	)
+
+	// In-flight jobs are cancelled before waiting for them.
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	br := bufio.NewReader(conn)
+
+	for {
+		m, err := readMessage(br)
+		if err != nil {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		switch m.Type {
+		case msgJob:
+			var j J
+
+			if err := json.Unmarshal(m.Job, &j); err != nil {
+				send(message{Type: msgResult, ID: m.ID, Err: err.Error()})
+				continue
+			}
+
+			jctx, jcancel := context.WithCancel(ctx)
+
+			mu.Lock()
+			jobs[m.ID] = jcancel
+			mu.Unlock()
+
+			wg.Add(1)
+
+			go func(id uint64) {
+				defer wg.Done()
+
+				reply := w.process(jctx, id, j)
+
+				mu.Lock()
+				delete(jobs, id)
+				mu.Unlock()
+
+				jcancel()
+
+				// Jobs interrupted by the worker shutdown are not
+				// replied, so the coordinator retries them.
+				if ctx.Err() == nil {
+					send(reply)
+				}
+			}(m.ID)
+
+		case msgCancel:
+			mu.Lock()
+			if jcancel, ok := jobs[m.ID]; ok {
+				jcancel()
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+// process processes job and returns result message,
+// processor panic is recovered into error.
+func (w *Worker[J, R]) process(ctx context.Context, id uint64, j J) (reply message) {
+	reply = message{Type: msgResult, ID: id}
+
+	defer func() {
+		if v := recover(); v != nil {
+			reply = message{Type: msgResult, ID: id, Err: fmt.Sprintf("panic: %v", v)}
+		}
+	}()
+
+	var (
+		res   R
+		retry bool
+		err   error
+	)
+
+	if p, ok := w.processor.(ContextProcessor[J, R]); ok {
+		res, retry, err = p.ProcessContext(ctx, j)
+	} else {
+		res, retry, err = w.processor.Process(j)
+	}
+
+	reply.Retry = retry
+
+	if err != nil {
+		reply.Err = err.Error()
+	}
+
+	b, e := json.Marshal(res)
+	if e != nil {
+		reply.Err = e.Error()
+		return reply
+	}
+
+	reply.Result = b
+
+	return reply
+}
@@ -0,0 +1,356 @@
+package typed_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// serve starts coordinator on the listener and returns its address.
+func serve(t *testing.T, c *typed.Coordinator[int, int], network, addr string) net.Addr {
+	ln, err := net.Listen(network, addr)
+	require.NoError(t, err)
+
+	go c.Serve(ln)
+
+	t.Cleanup(func() {
+		c.Close()
+	})
+
+	return ln.Addr()
+}
+
+// connect starts remote worker connected to addr, it is stopped
+// when the returned function is called.
+func connect(t *testing.T, w *typed.Worker[int, int], addr net.Addr) (stop func()) {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		w.Serve(ctx, conn)
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+	}
+
+	t.Cleanup(stop)
+
+	return stop
+}
+
+// waitWorkers waits for the given number of connected workers.
+func waitWorkers(t *testing.T, c *typed.Coordinator[int, int], n int) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if workers, _ := c.Workers(); workers == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("%d workers are not connected", n)
+}
+
+func TestCoordinator(t *testing.T) {
+	networks := map[string]string{
+		"tcp":  "127.0.0.1:0",
+		"unix": filepath.Join(t.TempDir(), "coordinator.sock"),
+	}
+
+	for network, addr := range networks {
+		t.Run(network, func(t *testing.T) {
+			c := typed.NewCoordinator[int, int]()
+			a := serve(t, c, network, addr)
+
+			for i := 0; i < 3; i++ {
+				connect(t, typed.NewWorker[int, int](newProcessor(7, 8), 2), a)
+			}
+
+			waitWorkers(t, c, 3)
+
+			_, slots := c.Workers()
+			assert.Equal(t, 6, slots)
+
+			q := typed.New[int, int](c, slots, 100)
+			q.Start(context.Background())
+
+			var (
+				sum  int
+				errs []error
+			)
+
+			wg := sync.WaitGroup{}
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				var res int
+				for q.Next(&res) {
+					sum += res
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				var err error
+				for q.Err(&err) {
+					errs = append(errs, err)
+				}
+			}()
+
+			q.Add(100)
+
+			expected := 0
+			for j := 0; j < 100; j++ {
+				q.Schedule(j)
+				expected += j * j
+			}
+
+			q.Stop()
+			wg.Wait()
+
+			// Every worker has its own processor, so every one of them
+			// fails once if it gets the job.
+			assert.Equal(t, expected, sum)
+			require.NotEmpty(t, errs)
+
+			var re *typed.RemoteError
+			require.True(t, errors.As(errs[0], &re))
+			assert.Equal(t, errTest.Error(), re.Msg)
+		})
+	}
+}
+
+func TestCoordinator_WorkerLost(t *testing.T) {
+	c := typed.NewCoordinator[int, int]()
+	a := serve(t, c, "tcp", "127.0.0.1:0")
+
+	started := make(chan int, 4)
+
+	stop := connect(t, typed.NewWorker[int, int](typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+		started <- j
+		<-ctx.Done()
+		return 0, false, ctx.Err()
+	}), 4), a)
+
+	waitWorkers(t, c, 1)
+
+	q := typed.New[int, int](c, 4, 10)
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+	q.Add(4)
+
+	for j := 0; j < 4; j++ {
+		q.Schedule(j)
+	}
+
+	for j := 0; j < 4; j++ {
+		<-started
+	}
+
+	connect(t, typed.NewWorker[int, int](newProcessor(-1, -1), 2), a)
+	waitWorkers(t, c, 2)
+
+	stop()
+
+	q.Stop()
+
+	count := 0
+	for o := range outcomes {
+		count++
+		assert.NoError(t, o.Err)
+		assert.Equal(t, o.Job*o.Job, o.Result)
+		assert.Equal(t, 2, o.Attempts)
+	}
+
+	assert.Equal(t, 4, count)
+	assert.Equal(t, uint64(4), q.Stats().Retries)
+}
+
+func TestCoordinator_Heartbeat(t *testing.T) {
+	c := typed.NewCoordinator[int, int]()
+	c.SetTimeout(50 * time.Millisecond)
+
+	a := serve(t, c, "tcp", "127.0.0.1:0")
+
+	// Fake worker which takes a job and hangs.
+	conn, err := net.Dial(a.Network(), a.String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hello := []byte(`{"type":"hello","slots":1}`)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(hello)))
+
+	_, err = conn.Write(append(size, hello...))
+	require.NoError(t, err)
+
+	waitWorkers(t, c, 1)
+
+	q := typed.New[int, int](c, 1, 10)
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+	q.Add(1)
+	q.Schedule(3)
+
+	// Wait for the job to be leased.
+	r := bufio.NewReader(conn)
+	_, err = io.ReadFull(r, size)
+	require.NoError(t, err)
+
+	w := typed.NewWorker[int, int](newProcessor(-1, -1), 1)
+	w.SetHeartbeat(10 * time.Millisecond)
+	connect(t, w, a)
+
+	q.Stop()
+
+	select {
+	case o := <-outcomes:
+		assert.NoError(t, o.Err)
+		assert.Equal(t, 9, o.Result)
+		assert.Equal(t, 2, o.Attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job is not processed")
+	}
+
+	waitDone(t, q)
+}
+
+// fakeWorker is a remote worker connection driven by the test.
+type fakeWorker struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialFake(t *testing.T, a net.Addr, slots int) *fakeWorker {
+	conn, err := net.Dial(a.Network(), a.String())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	w := &fakeWorker{conn: conn, r: bufio.NewReader(conn)}
+	w.send(t, fmt.Sprintf(`{"type":"hello","slots":%d}`, slots))
+
+	return w
+}
+
+func (w *fakeWorker) send(t *testing.T, msg string) {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(msg)))
+
+	_, err := w.conn.Write(append(size, msg...))
+	require.NoError(t, err)
+}
+
+// job reads the next job and returns its ID, it returns false
+// if there is no job for the timeout.
+func (w *fakeWorker) job(t *testing.T, timeout time.Duration) (uint64, bool) {
+	w.conn.SetReadDeadline(time.Now().Add(timeout))
+
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(w.r, size); err != nil {
+		var ne net.Error
+		require.True(t, errors.As(err, &ne) && ne.Timeout(), err)
+		return 0, false
+	}
+
+	b := make([]byte, binary.BigEndian.Uint32(size))
+	_, err := io.ReadFull(w.r, b)
+	require.NoError(t, err)
+
+	var m struct {
+		Type string `json:"type"`
+		ID   uint64 `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(b, &m))
+	require.Equal(t, "job", m.Type)
+
+	return m.ID, true
+}
+
+func TestCoordinator_StrayResults(t *testing.T) {
+	c := typed.NewCoordinator[int, int]()
+	a := serve(t, c, "tcp", "127.0.0.1:0")
+
+	w := dialFake(t, a, 1)
+	waitWorkers(t, c, 1)
+
+	q := typed.New[int, int](c, 3, 10)
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+	q.Add(3)
+
+	for j := 0; j < 3; j++ {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+
+	// The first result is sent twice and followed by result
+	// of a job which was never handed out.
+	id, ok := w.job(t, 5*time.Second)
+	require.True(t, ok)
+
+	result := fmt.Sprintf(`{"type":"result","id":%d,"result":1}`, id)
+	w.send(t, result)
+	w.send(t, result)
+	w.send(t, `{"type":"result","id":1000,"result":1}`)
+
+	// The worker has a single slot, so jobs are handed out one by one.
+	for i := 0; i < 2; i++ {
+		id, ok := w.job(t, 5*time.Second)
+		require.True(t, ok)
+
+		_, ok = w.job(t, 50*time.Millisecond)
+		require.False(t, ok, "more jobs than slots")
+
+		w.send(t, fmt.Sprintf(`{"type":"result","id":%d,"result":1}`, id))
+	}
+
+	count := 0
+	for o := range outcomes {
+		assert.NoError(t, o.Err)
+		count++
+	}
+
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, c.ProtocolErrors())
+}
+
+func TestCoordinator_Close(t *testing.T) {
+	c := typed.NewCoordinator[int, int]()
+	serve(t, c, "tcp", "127.0.0.1:0")
+
+	assert.NoError(t, c.Close())
+
+	_, _, err := c.Process(1)
+	assert.Equal(t, typed.ErrCoordinatorClosed, err)
+}
@@ -0,0 +1,141 @@
+package typed
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides whether and when a job is retried after
+// the processor asked to retry it because of an error.
+type RetryPolicy interface {
+	// Retry returns delay before the next attempt and false if
+	// the job must not be retried after the given number of attempts.
+	Retry(attempts int, err error) (time.Duration, bool)
+}
+
+// Backoff returns delay before the next attempt after
+// the given number of attempts.
+type Backoff func(attempts int) time.Duration
+
+// Constant returns backoff with the same delay before every attempt.
+func Constant(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// Exponential returns backoff which starts with base delay and doubles
+// it on every attempt up to max. Zero max means no limit.
+func Exponential(base, max time.Duration) Backoff {
+	return func(attempts int) time.Duration {
+		d := base
+
+		for i := 1; i < attempts; i++ {
+			d *= 2
+
+			if max > 0 && d >= max {
+				return max
+			}
+		}
+
+		if max > 0 && d > max {
+			return max
+		}
+
+		return d
+	}
+}
+
+// Jittered returns backoff with random delay in range [d/2, d),
+// where d is delay of the given backoff.
+func Jittered(b Backoff) Backoff {
+	return func(attempts int) time.Duration {
+		d := b(attempts)
+
+		if d <= 1 {
+			return d
+		}
+
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+	}
+}
+
+// Retry is a configurable retry policy.
+type Retry struct {
+	// MaxAttempts is maximum number of attempts per job.
+	// Zero means unlimited number of attempts.
+	MaxAttempts int
+
+	// Backoff is delay before the next attempt. Nil means no delay.
+	Backoff Backoff
+
+	// If limits retries to errors it returns true for.
+	// Nil means any error is retried.
+	If func(error) bool
+}
+
+var _ RetryPolicy = Retry{}
+
+// Retry implements RetryPolicy.
+func (r Retry) Retry(attempts int, err error) (time.Duration, bool) {
+	if r.MaxAttempts > 0 && attempts >= r.MaxAttempts {
+		return 0, false
+	}
+
+	if r.If != nil && !r.If(err) {
+		return 0, false
+	}
+
+	if r.Backoff == nil {
+		return 0, true
+	}
+
+	return r.Backoff(attempts), true
+}
+
+// RetryOn returns function for Retry.If which matches
+// errors wrapping any of the given errors.
+func RetryOn(targets ...error) func(error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// RetryAfter returns error which makes the queue delay the next attempt
+// of the job by d instead of the retry policy delay. The policy still
+// decides whether the job is retried. It is meant for processors which
+// know the delay themselves, the error unwraps to err.
+func RetryAfter(err error, d time.Duration) error {
+	return &retryAfterError{err: err, delay: d}
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// retryDelay returns delay of the error made by RetryAfter.
+func retryDelay(err error) (time.Duration, bool) {
+	var e *retryAfterError
+
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+
+	return e.delay, true
+}
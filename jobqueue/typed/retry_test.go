@@ -0,0 +1,197 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestBackoff(t *testing.T) {
+	c := typed.Constant(time.Second)
+	assert.Equal(t, time.Second, c(1))
+	assert.Equal(t, time.Second, c(10))
+
+	e := typed.Exponential(100*time.Millisecond, time.Second)
+	assert.Equal(t, 100*time.Millisecond, e(1))
+	assert.Equal(t, 200*time.Millisecond, e(2))
+	assert.Equal(t, 800*time.Millisecond, e(4))
+	assert.Equal(t, time.Second, e(5))
+	assert.Equal(t, time.Second, e(64))
+
+	j := typed.Jittered(c)
+	for i := 0; i < 100; i++ {
+		d := j(1)
+		assert.True(t, d >= 500*time.Millisecond && d < time.Second, d)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTemporary := errors.New("temporary")
+
+	r := typed.Retry{
+		MaxAttempts: 3,
+		Backoff:     typed.Constant(time.Second),
+		If:          typed.RetryOn(errTemporary),
+	}
+
+	d, ok := r.Retry(1, fmt.Errorf("wrapped: %w", errTemporary))
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, d)
+
+	_, ok = r.Retry(1, errTest)
+	assert.False(t, ok)
+
+	_, ok = r.Retry(3, errTemporary)
+	assert.False(t, ok)
+
+	d, ok = typed.Retry{}.Retry(100, errTest)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+}
+
+func TestQueue_RetryPolicy(t *testing.T) {
+	const jobs = 20
+
+	// Odd jobs always fail, even jobs fail on the first attempt only.
+	attempts := make([]int, jobs)
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		attempts[j]++
+
+		if j%2 == 1 || attempts[j] == 1 {
+			return 0, true, errTest
+		}
+
+		return j, false, nil
+	}), 1, jobs)
+
+	q.SetRetryPolicy(typed.Retry{
+		MaxAttempts: 3,
+		Backoff:     typed.Exponential(time.Millisecond, 10*time.Millisecond),
+	})
+
+	outcomes := q.Outcomes()
+
+	start := time.Now()
+
+	q.Start(context.Background())
+	q.Add(jobs)
+
+	for j := 0; j < jobs; j++ {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+
+	failed := 0
+
+	for o := range outcomes {
+		if o.Job%2 == 1 {
+			failed++
+			assert.Equal(t, errTest, o.Err)
+			assert.Equal(t, 3, o.Attempts)
+		} else {
+			assert.NoError(t, o.Err)
+			assert.Equal(t, 2, o.Attempts)
+		}
+	}
+
+	// Every odd job waits 1ms + 2ms before retries.
+	assert.True(t, time.Since(start) >= 3*time.Millisecond)
+
+	assert.Equal(t, jobs/2, failed)
+	assert.Equal(t, float64(1), q.Progress())
+
+	dead := q.DeadLetters()
+	require.Len(t, dead, jobs/2)
+
+	for _, o := range dead {
+		assert.Equal(t, 1, o.Job%2)
+	}
+}
+
+func TestQueue_RetryAfterError(t *testing.T) {
+	attempts := make([]int, 2)
+
+	// Job 1 always fails, job 0 fails on the first attempt only.
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		attempts[j]++
+
+		if j == 1 || attempts[j] == 1 {
+			return 0, true, typed.RetryAfter(errTest, 10*time.Millisecond)
+		}
+
+		return j, false, nil
+	}), 1, 2)
+
+	// Delay of the error overrides the backoff, but not max attempts.
+	q.SetRetryPolicy(typed.Retry{
+		MaxAttempts: 3,
+		Backoff:     typed.Constant(time.Hour),
+	})
+
+	outcomes := q.Outcomes()
+
+	start := time.Now()
+
+	q.Start(context.Background())
+	q.Add(2)
+	q.Schedule(0)
+	q.Schedule(1)
+	q.Stop()
+
+	res := make(map[int]typed.Outcome[int, int])
+	for o := range outcomes {
+		res[o.Job] = o
+	}
+
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Minute)
+
+	require.Len(t, res, 2)
+
+	assert.NoError(t, res[0].Err)
+	assert.Equal(t, 2, res[0].Attempts)
+
+	assert.True(t, errors.Is(res[1].Err, errTest))
+	assert.Equal(t, errTest.Error(), res[1].Err.Error())
+	assert.Equal(t, 3, res[1].Attempts)
+	assert.Len(t, q.DeadLetters(), 1)
+}
+
+func TestQueue_RetryAfterStop(t *testing.T) {
+	// Retries must not panic or be lost after Stop.
+	retried := false
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if !retried {
+			retried = true
+			return 0, true, errTest
+		}
+		return j, false, nil
+	}), 1, 1)
+
+	q.SetRetryPolicy(typed.Retry{Backoff: typed.Constant(10 * time.Millisecond)})
+
+	outcomes := q.Outcomes()
+
+	q.Start(context.Background())
+	q.Add(1)
+	q.Schedule(42)
+	q.Stop()
+
+	o, ok := <-outcomes
+	require.True(t, ok)
+	assert.Equal(t, 42, o.Result)
+	assert.Equal(t, 2, o.Attempts)
+
+	_, ok = <-outcomes
+	assert.False(t, ok)
+}
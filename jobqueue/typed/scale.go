@@ -0,0 +1,196 @@
+package typed
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Window represents the queue health during the last interval,
+// see Scaler.
+type Window struct {
+	// Attempts is number of processed attempts.
+	Attempts uint64
+
+	// Errors is number of attempts which returned an error.
+	Errors uint64
+
+	// Latency is mean attempt processing time.
+	Latency time.Duration
+
+	// Queued is number of jobs waiting to be processed.
+	Queued int
+}
+
+// ErrorRate returns ratio of errors to attempts.
+func (w Window) ErrorRate() float64 {
+	if w.Attempts == 0 {
+		return 0
+	}
+
+	return float64(w.Errors) / float64(w.Attempts)
+}
+
+// Scaler decides number of workers, see Autoscale.
+type Scaler interface {
+	// Scale returns new number of workers given the current one
+	// and the queue health during the last interval.
+	Scale(workers int, w Window) int
+}
+
+// AIMD is a Scaler which multiplicatively decreases number of workers
+// when the error rate or latency are too high and additively increases
+// it when things are healthy and there are queued jobs.
+type AIMD struct {
+	// Min and Max limit number of workers.
+	Min int
+	Max int
+
+	// Increase is number of workers added on every healthy interval.
+	// Default is 1.
+	Increase int
+
+	// Decrease is factor number of workers is multiplied by on every
+	// unhealthy interval. Default is 0.5.
+	Decrease float64
+
+	// MaxErrorRate is the highest healthy error rate.
+	MaxErrorRate float64
+
+	// MaxLatency is the highest healthy mean latency.
+	// Zero means latency is not checked.
+	MaxLatency time.Duration
+}
+
+var _ Scaler = AIMD{}
+
+// Scale implements Scaler.
+func (a AIMD) Scale(workers int, w Window) int {
+	increase, decrease := a.Increase, a.Decrease
+
+	if increase <= 0 {
+		increase = 1
+	}
+
+	if decrease <= 0 || decrease >= 1 {
+		decrease = 0.5
+	}
+
+	n := workers
+
+	switch {
+	case w.ErrorRate() > a.MaxErrorRate,
+		a.MaxLatency > 0 && w.Latency > a.MaxLatency:
+		n = int(float64(workers) * decrease)
+
+	case w.Queued > 0:
+		n = workers + increase
+	}
+
+	if n < a.Min {
+		n = a.Min
+	}
+
+	if a.Max > 0 && n > a.Max {
+		n = a.Max
+	}
+
+	return n
+}
+
+// SetWorkers changes number of workers, it may be called on a running
+// queue. Extra workers exit after their current jobs are processed.
+// There is always at least one worker.
+func (q *Queue[J, R]) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	q.workersMu.Lock()
+	defer q.workersMu.Unlock()
+
+	atomic.StoreInt64(&q.workersTarget, int64(n))
+
+	// Not started or finished queue.
+	if q.ctx == nil || q.stopped {
+		return
+	}
+
+	for atomic.LoadInt64(&q.workersRunning) < int64(n) {
+		q.spawn()
+	}
+
+	q.todo.wakeAll()
+}
+
+// Workers returns the current number of workers.
+func (q *Queue[J, R]) Workers() int {
+	return int(atomic.LoadInt64(&q.workersRunning))
+}
+
+// Autoscale calls scaler every interval and sets the number of workers
+// it returns until the queue is finished. Must be called after Start.
+func (q *Queue[J, R]) Autoscale(interval time.Duration, scaler Scaler) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		attempts := atomic.LoadUint64(&q.attempts)
+		errs := atomic.LoadUint64(&q.failures)
+		busy := atomic.LoadInt64(&q.busy)
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-q.finished:
+				return
+			}
+
+			a, e, b := atomic.LoadUint64(&q.attempts), atomic.LoadUint64(&q.failures), atomic.LoadInt64(&q.busy)
+
+			w := Window{
+				Attempts: a - attempts,
+				Errors:   e - errs,
+				Queued:   q.todo.len(),
+			}
+
+			if w.Attempts > 0 {
+				w.Latency = time.Duration(b-busy) / time.Duration(w.Attempts)
+			}
+
+			attempts, errs, busy = a, e, b
+
+			// Paused queue is neither healthy nor overloaded.
+			if q.State() == StatePaused {
+				continue
+			}
+
+			q.SetWorkers(scaler.Scale(q.Workers(), w))
+		}
+	}()
+}
+
+// spawn starts a new worker, workersMu must be held.
+func (q *Queue[J, R]) spawn() {
+	atomic.AddInt64(&q.workersRunning, 1)
+	q.workersWG.Add(1)
+
+	go q.worker(q.workersSpawned)
+
+	q.workersSpawned++
+}
+
+// retire returns true if the calling worker must exit
+// because there are too many workers.
+func (q *Queue[J, R]) retire() bool {
+	for {
+		running := atomic.LoadInt64(&q.workersRunning)
+
+		if running <= atomic.LoadInt64(&q.workersTarget) {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&q.workersRunning, running, running-1) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package typed_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+func TestAIMD(t *testing.T) {
+	a := typed.AIMD{Min: 2, Max: 10, MaxErrorRate: 0.1, MaxLatency: time.Second}
+
+	healthy := typed.Window{Attempts: 100, Errors: 5, Latency: 100 * time.Millisecond, Queued: 10}
+
+	assert.Equal(t, 5, a.Scale(4, healthy))
+	assert.Equal(t, 10, a.Scale(10, healthy))
+
+	idle := healthy
+	idle.Queued = 0
+	assert.Equal(t, 4, a.Scale(4, idle))
+
+	errs := healthy
+	errs.Errors = 50
+	assert.Equal(t, 4, a.Scale(8, errs))
+	assert.Equal(t, 2, a.Scale(3, errs))
+
+	slow := healthy
+	slow.Latency = 2 * time.Second
+	assert.Equal(t, 4, a.Scale(8, slow))
+}
+
+// concurrency returns processor which tracks the maximum number
+// of concurrently processed jobs since the last reset.
+func concurrency(delay time.Duration) (typed.ProcessorFunc[int, int], func() int64) {
+	var cur, max int64
+
+	p := func(j int) (int, bool, error) {
+		n := atomic.AddInt64(&cur, 1)
+		defer atomic.AddInt64(&cur, -1)
+
+		for {
+			m := atomic.LoadInt64(&max)
+			if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(delay)
+
+		return j, false, nil
+	}
+
+	reset := func() int64 {
+		return atomic.SwapInt64(&max, 0)
+	}
+
+	return p, reset
+}
+
+func TestQueue_SetWorkers(t *testing.T) {
+	proc, reset := concurrency(time.Millisecond)
+
+	q := typed.New[int, int](proc, 2, 100)
+	q.Start(context.Background())
+
+	go func() {
+		var res int
+		for q.Next(&res) {
+		}
+	}()
+
+	run := func(n int) {
+		q.Add(n)
+		for j := 0; j < n; j++ {
+			q.Schedule(j)
+		}
+
+		q.WaitJobs()
+	}
+
+	run(50)
+	assert.Equal(t, 2, q.Workers())
+	assert.Equal(t, int64(2), reset())
+
+	q.SetWorkers(8)
+	assert.Equal(t, 8, q.Workers())
+
+	run(100)
+	assert.Equal(t, int64(8), reset())
+
+	q.SetWorkers(3)
+
+	// Idle workers exit right away.
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 3, q.Workers())
+
+	run(50)
+	assert.Equal(t, int64(3), reset())
+
+	q.SetWorkers(0)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, q.Workers())
+
+	assert.NoError(t, q.Shutdown(context.Background()))
+	assert.Equal(t, 0, q.Workers())
+}
+
+func TestQueue_SetWorkersWhileFinishing(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 10)
+		outcomes := q.Outcomes()
+
+		q.Start(context.Background())
+
+		stop := make(chan struct{})
+		scaled := make(chan struct{})
+
+		// Workers are spawned and retired while the last one exits.
+		go func() {
+			defer close(scaled)
+
+			for n := 1; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				q.SetWorkers(n%4 + 1)
+			}
+		}()
+
+		q.Add(10)
+		for j := 0; j < 10; j++ {
+			q.Schedule(j)
+		}
+
+		q.Stop()
+
+		count := 0
+		for range outcomes {
+			count++
+		}
+
+		close(stop)
+		<-scaled
+
+		assert.Equal(t, 10, count)
+		assert.Equal(t, 0, q.Workers())
+	}
+}
+
+func TestQueue_Autoscale(t *testing.T) {
+	proc, _ := concurrency(time.Millisecond)
+
+	q := typed.New[int, int](proc, 1, 1000)
+	q.Start(context.Background())
+	q.Autoscale(5*time.Millisecond, typed.AIMD{Min: 1, Max: 4})
+
+	q.Add(1000)
+	for j := 0; j < 1000; j++ {
+		q.Schedule(j)
+	}
+
+	go func() {
+		var res int
+		for q.Next(&res) {
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 4, q.Workers())
+
+	assert.NoError(t, q.Shutdown(context.Background()))
+}
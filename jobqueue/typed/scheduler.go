@@ -0,0 +1,896 @@
+package typed
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scheduler holds tasks waiting to be processed: scheduled ones
+// and the ones delayed before retry.
+//
+// Tasks with higher priority are always taken first. Tasks of the same
+// priority are taken from groups in proportion to their weights using
+// stride scheduling: every group has a pass which grows by 1/weight
+// on every taken task and the group with the lowest pass goes next.
+type scheduler[J any] struct {
+	mu sync.Mutex
+
+	// ready is signalled when a task becomes available or
+	// there will be no tasks anymore.
+	ready *sync.Cond
+
+	// capacity is the maximum number of pending tasks per group.
+	capacity int
+
+	// groups are all the groups, the first one is the default.
+	groups []*group[J]
+	def    *group[J]
+
+	// pending is the number of pending tasks in all the groups.
+	pending int
+
+	// vtime is the pass of the last taken group, groups which
+	// become active start from it, so they do not get extra share
+	// for the time they were idle.
+	vtime float64
+
+	delayed delayedHeap[J]
+	timer   *time.Timer
+
+	// inflight are taken tasks which are not done yet,
+	// they can come back as retries.
+	inflight map[uint64]task[J]
+
+	// seq is sequence number of the next task.
+	seq uint64
+
+	// position is number of pushed tasks, see Checkpoint.
+	position uint64
+
+	// window limits how far ahead of next, the sequence number
+	// of the first not emitted task, new tasks may be taken,
+	// zero means no limit, see SetOrdered.
+	window uint64
+	next   uint64
+
+	closed bool
+
+	// paused scheduler does not give out tasks until it is unpaused.
+	paused bool
+
+	// aborted scheduler does not give out tasks anymore,
+	// all the remaining tasks are moved to cancelled and
+	// jobs pushed after abort are rejected.
+	aborted   bool
+	cancelled []task[J]
+	rejected  []J
+
+	// dropped are tasks of cancelled groups to be reported.
+	dropped fifo[task[J]]
+
+	// Spill state, see SetSpill. spillFailed is closed when spilled
+	// tasks can not be read back.
+	spillDir    string
+	spillTmp    string
+	spillErr    error
+	spillFailed chan struct{}
+	spillWG     sync.WaitGroup
+}
+
+// pushStatus is a result of scheduler push.
+type pushStatus int
+
+const (
+	pushed pushStatus = iota
+
+	// pushAborted means the scheduler is aborted.
+	pushAborted
+
+	// pushCancelled means the task group is cancelled.
+	pushCancelled
+)
+
+func newScheduler[J any](capacity int) *scheduler[J] {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	s := &scheduler[J]{
+		capacity: capacity,
+		inflight: make(map[uint64]task[J]),
+	}
+
+	s.ready = sync.NewCond(&s.mu)
+	s.def = s.newGroup("", 1)
+
+	return s
+}
+
+// newGroup adds a new group with the given weight.
+func (s *scheduler[J]) newGroup(name string, weight int) *group[J] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := &group[J]{
+		id:     len(s.groups),
+		name:   name,
+		weight: weight,
+		pass:   s.vtime,
+		space:  sync.NewCond(&s.mu),
+	}
+
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+
+	s.groups = append(s.groups, g)
+
+	return g
+}
+
+// push adds a new task and sets its sequence number,
+// it blocks while the task group is full unless the task is spilled.
+func (s *scheduler[J]) push(pt *task[J]) pushStatus {
+	s.mu.Lock()
+
+	status, spill := s.pushLocked(pt)
+	if spill {
+		// Scheduler mutex is released before the task is written.
+		s.spillTask(*pt)
+		return status
+	}
+
+	s.mu.Unlock()
+
+	return status
+}
+
+// pushLocked is push with scheduler mutex held, it returns true
+// if the task must be spilled.
+func (s *scheduler[J]) pushLocked(pt *task[J]) (pushStatus, bool) {
+	if pt.group == nil {
+		pt.group = s.def
+	}
+
+	t := pt
+	g := t.group
+
+	spill := false
+
+	for !s.closed && !g.cancelled {
+		if spill = s.spillable(g); spill || g.pending < s.capacity {
+			break
+		}
+
+		g.space.Wait()
+	}
+
+	if s.closed && !s.aborted {
+		panic("jobqueue: schedule on stopped queue")
+	}
+
+	s.position++
+
+	if s.aborted {
+		s.rejected = append(s.rejected, t.job)
+		return pushAborted, false
+	}
+
+	t.seq = s.seq
+	s.seq++
+
+	if g.cancelled {
+		g.cancelledJobs = append(g.cancelledJobs, t.job)
+		return pushCancelled, false
+	}
+
+	if spill {
+		return pushed, true
+	}
+
+	s.enqueue(*t, false)
+
+	return pushed, false
+}
+
+// skip counts a job which is not pushed in position.
+func (s *scheduler[J]) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.position++
+}
+
+// retry adds a task taken before back after the delay.
+// Retries are not limited by capacity, so workers never block on them.
+// With window they go first, so new tasks out of the window do not
+// block them.
+// It returns false if the task group is cancelled.
+func (s *scheduler[J]) retry(t task[J], delay time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.aborted {
+		s.cancelled = append(s.cancelled, t)
+		return true
+	}
+
+	if t.group.cancelled {
+		t.group.cancelledJobs = append(t.group.cancelledJobs, t.job)
+		return false
+	}
+
+	if delay <= 0 {
+		s.enqueue(t, s.window > 0)
+		return true
+	}
+
+	heap.Push(&s.delayed, delayedTask[J]{due: time.Now().Add(delay), task: t})
+	s.arm()
+
+	return true
+}
+
+// take returns the next task, it blocks while there are no tasks.
+// Dropped tasks are returned first.
+// It returns false when the scheduler is aborted or closed
+// and there are no tasks left or when retire returns true.
+func (s *scheduler[J]) take(retire func() bool) (task[J], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.aborted || retire() {
+			return task[J]{}, false
+		}
+
+		// Dropped tasks are only reported, so they are given out
+		// even while paused.
+		if s.dropped.len() > 0 {
+			t := s.dropped.pop()
+
+			if s.finished() {
+				s.ready.Broadcast()
+			}
+
+			return t, true
+		}
+
+		if !s.paused {
+			if next, i := s.pick(); next != nil {
+				s.vtime = next.pass
+				next.pass += 1 / float64(next.weight)
+
+				t := next.dequeue(i)
+				s.pending--
+
+				next.inflight++
+				s.inflight[t.seq] = t
+
+				// Spill reader waits for space along with pushers,
+				// which do not take it while there are spilled tasks.
+				if next.spill != nil {
+					next.space.Broadcast()
+				} else {
+					next.space.Signal()
+				}
+
+				return t, true
+			}
+		}
+
+		if s.finished() {
+			return task[J]{}, false
+		}
+
+		s.ready.Wait()
+	}
+}
+
+// pick returns group and its level index of the next task to take:
+// the highest priority one from the group with the lowest pass.
+// Only tasks within the window are considered.
+func (s *scheduler[J]) pick() (*group[J], int) {
+	var (
+		next  *group[J]
+		level int
+	)
+
+	for _, g := range s.groups {
+		i := g.first(s.takeable)
+		if i < 0 {
+			continue
+		}
+
+		p, np := g.levels[i].priority, 0
+		if next != nil {
+			np = next.levels[level].priority
+		}
+
+		if next == nil || p > np || p == np && g.pass < next.pass {
+			next, level = g, i
+		}
+	}
+
+	return next, level
+}
+
+// takeable returns true if task is within the window.
+func (s *scheduler[J]) takeable(t task[J]) bool {
+	return s.window == 0 || t.seq < s.next+s.window
+}
+
+// setWindow sets window, see SetOrdered.
+func (s *scheduler[J]) setWindow(window uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.window = window
+}
+
+// advance sets sequence number of the first not emitted task.
+func (s *scheduler[J]) advance(next uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next = next
+	s.ready.Broadcast()
+}
+
+// done must be called for every taken task after it is processed
+// and retried if required.
+func (s *scheduler[J]) done(t task[J]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inflight, t.seq)
+	t.group.inflight--
+
+	if s.finished() {
+		s.ready.Broadcast()
+	}
+}
+
+// pause stops or restarts giving out tasks.
+func (s *scheduler[J]) pause(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = paused
+	s.ready.Broadcast()
+}
+
+// state returns whether the scheduler is paused and closed.
+func (s *scheduler[J]) state() (paused, closed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.paused, s.closed
+}
+
+// wakeAll wakes up all the waiting takers.
+func (s *scheduler[J]) wakeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ready.Broadcast()
+}
+
+// close tells that there will be no new tasks.
+func (s *scheduler[J]) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.broadcast()
+	spills := s.spills()
+	s.mu.Unlock()
+
+	closeSpills(spills)
+}
+
+// abort closes the scheduler and cancels all the remaining tasks.
+func (s *scheduler[J]) abort() {
+	s.mu.Lock()
+
+	if s.aborted {
+		s.mu.Unlock()
+		return
+	}
+
+	s.closed = true
+	s.aborted = true
+
+	for _, g := range s.groups {
+		s.cancelled = append(s.cancelled, g.drain()...)
+	}
+
+	s.pending = 0
+
+	for s.delayed.Len() > 0 {
+		dt := heap.Pop(&s.delayed).(delayedTask[J])
+		s.cancelled = append(s.cancelled, dt.task)
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	s.broadcast()
+	spills := s.spills()
+	s.mu.Unlock()
+
+	// Spilled tasks are cancelled by spill readers.
+	closeSpills(spills)
+}
+
+// cancelGroup cancels group and moves its pending and delayed tasks
+// to dropped, so they are reported by workers, see take.
+// Tasks of cancelled group pushed or retried later are rejected.
+func (s *scheduler[J]) cancelGroup(g *group[J]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g.cancelled {
+		return
+	}
+
+	g.cancelled = true
+	g.cancel()
+
+	// Spilled tasks are dropped by spill reader.
+	tasks := g.drain()
+	s.pending -= len(tasks)
+
+	delayed := s.delayed[:0]
+
+	for _, dt := range s.delayed {
+		if dt.task.group == g {
+			tasks = append(tasks, dt.task)
+			continue
+		}
+
+		delayed = append(delayed, dt)
+	}
+
+	clear(s.delayed[len(delayed):])
+	s.delayed = delayed
+	heap.Init(&s.delayed)
+
+	for _, t := range tasks {
+		g.cancelledJobs = append(g.cancelledJobs, t.job)
+
+		t.dropped = true
+		s.dropped.push(t)
+	}
+
+	g.space.Broadcast()
+	s.ready.Broadcast()
+}
+
+// droppedTasks removes and returns dropped tasks
+// which were not reported by workers.
+func (s *scheduler[J]) droppedTasks() []task[J] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]task[J], 0, s.dropped.len())
+
+	for s.dropped.len() > 0 {
+		tasks = append(tasks, s.dropped.pop())
+	}
+
+	return tasks
+}
+
+// cancelledTasks returns tasks cancelled on abort.
+func (s *scheduler[J]) cancelledTasks() []task[J] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancelled := make([]task[J], len(s.cancelled))
+	copy(cancelled, s.cancelled)
+
+	return cancelled
+}
+
+// cancelledJobs returns jobs of tasks cancelled on abort and
+// jobs rejected after it.
+func (s *scheduler[J]) cancelledJobs() []J {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]J, 0, len(s.cancelled)+len(s.rejected))
+
+	for _, t := range s.cancelled {
+		jobs = append(jobs, t.job)
+	}
+
+	return append(jobs, s.rejected...)
+}
+
+// groupCancelledJobs returns jobs of the cancelled group.
+func (s *scheduler[J]) groupCancelledJobs(g *group[J]) []J {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]J, len(g.cancelledJobs))
+	copy(jobs, g.cancelledJobs)
+
+	return jobs
+}
+
+// restore sets position and adds jobs restored from checkpoint to
+// the default group. Restored jobs are not limited by capacity and
+// not counted in position.
+func (s *scheduler[J]) restore(position uint64, jobs []J) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.position = position
+
+	for _, j := range jobs {
+		s.enqueue(task[J]{job: j, seq: s.seq, group: s.def}, false)
+		s.seq++
+	}
+
+	s.ready.Broadcast()
+}
+
+// snapshot returns position and jobs of all the unfinished tasks:
+// pending, delayed, in-flight and cancelled ones in scheduling order.
+// Tasks of cancelled groups are not included.
+func (s *scheduler[J]) snapshot() (uint64, []J) {
+	s.mu.Lock()
+
+	// Retried task can be both in-flight and pending for a moment.
+	tasks := make(map[uint64]task[J])
+
+	add := func(t task[J]) {
+		if !t.group.cancelled {
+			tasks[t.seq] = t
+		}
+	}
+
+	// Spilled tasks are read after the mutex is released.
+	views := make(map[*group[J]]spillView[J])
+
+	for _, g := range s.groups {
+		for i := range g.levels {
+			g.levels[i].tasks.each(add)
+		}
+
+		if g.spill != nil && !g.cancelled {
+			views[g] = s.view(g)
+		}
+	}
+
+	for _, dt := range s.delayed {
+		add(dt.task)
+	}
+
+	for _, t := range s.inflight {
+		add(t)
+	}
+
+	for _, t := range s.cancelled {
+		add(t)
+	}
+
+	seq, position := s.seq, s.position
+	rejected := append([]J(nil), s.rejected...)
+
+	s.mu.Unlock()
+
+	for g, v := range views {
+		err := v.each(seq, func(rec spillRecord[J]) {
+			tasks[rec.Seq] = task[J]{job: rec.Job, seq: rec.Seq, group: g, priority: rec.Priority}
+		})
+		if err != nil {
+			s.mu.Lock()
+			s.setSpillErr(err)
+			s.mu.Unlock()
+		}
+	}
+
+	seqs := make([]uint64, 0, len(tasks))
+	for seq := range tasks {
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+
+	jobs := make([]J, 0, len(seqs)+len(rejected))
+
+	for _, seq := range seqs {
+		jobs = append(jobs, tasks[seq].job)
+	}
+
+	return position, append(jobs, rejected...)
+}
+
+// counts returns number of tasks waiting to be processed,
+// number of spilled ones among them and number of in-flight tasks.
+func (s *scheduler[J]) counts() (queued, spilled, inflight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spilled = s.spilled()
+
+	return s.pending + spilled + s.delayed.Len(), spilled, len(s.inflight)
+}
+
+// groupCounts returns number of tasks of the group waiting
+// to be processed and number of its in-flight tasks.
+func (s *scheduler[J]) groupCounts(g *group[J]) (queued, inflight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued = g.pending + g.spilled
+
+	for _, dt := range s.delayed {
+		if dt.task.group == g {
+			queued++
+		}
+	}
+
+	return queued, g.inflight
+}
+
+// len returns number of tasks waiting to be processed.
+func (s *scheduler[J]) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending + s.spilled() + s.delayed.Len()
+}
+
+func (s *scheduler[J]) finished() bool {
+	return s.closed && s.pending == 0 && s.spilled() == 0 && s.delayed.Len() == 0 &&
+		len(s.inflight) == 0 && s.dropped.len() == 0
+}
+
+// enqueue adds task to its group, see group.enqueue.
+func (s *scheduler[J]) enqueue(t task[J], front bool) {
+	g := t.group
+
+	if g.pending == 0 && g.pass < s.vtime {
+		g.pass = s.vtime
+	}
+
+	g.enqueue(t, front)
+	s.pending++
+	s.ready.Signal()
+}
+
+// broadcast wakes up all the waiting takers and pushers.
+func (s *scheduler[J]) broadcast() {
+	s.ready.Broadcast()
+
+	for _, g := range s.groups {
+		g.space.Broadcast()
+	}
+}
+
+// arm sets timer to the earliest delayed task.
+func (s *scheduler[J]) arm() {
+	if s.delayed.Len() == 0 {
+		return
+	}
+
+	d := time.Until(s.delayed[0].due)
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(d, s.wake)
+		return
+	}
+
+	s.timer.Reset(d)
+}
+
+// wake moves due delayed tasks to pending.
+func (s *scheduler[J]) wake() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for s.delayed.Len() > 0 && !s.delayed[0].due.After(now) {
+		dt := heap.Pop(&s.delayed).(delayedTask[J])
+		s.enqueue(dt.task, s.window > 0)
+	}
+
+	s.arm()
+}
+
+// group is a scheduler side of Group, it is guarded by scheduler mutex
+// except for atomic counters.
+type group[J any] struct {
+	id     int
+	name   string
+	weight int
+
+	// levels are pending tasks by priority in descending order.
+	levels  []level[J]
+	pending int
+
+	// spill holds tasks over capacity, see SetSpill. spilled is the
+	// number of tasks which are not moved back from spill yet, reserved
+	// is the number of tasks pushed to spill, unspilled is the number of
+	// tasks read back and lost is the number of tasks which could not
+	// be read back.
+	spill     *spill[J]
+	spilled   int
+	reserved  int
+	unspilled int
+	lost      int
+
+	inflight int
+	pass     float64
+
+	space *sync.Cond
+
+	// ctx is cancelled when the group is cancelled.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	cancelled     bool
+	cancelledJobs []J
+
+	// Counters, accessed atomically.
+	jobs      uint64
+	processed uint64
+	errors    uint64
+	rejected  uint64
+}
+
+// level is a FIFO of tasks with the same priority.
+type level[J any] struct {
+	priority int
+	tasks    fifo[task[J]]
+}
+
+// enqueue adds task to the end or, if front is true,
+// to the beginning of its priority level.
+func (g *group[J]) enqueue(t task[J], front bool) {
+	i := sort.Search(len(g.levels), func(i int) bool {
+		return g.levels[i].priority <= t.priority
+	})
+
+	if i == len(g.levels) || g.levels[i].priority != t.priority {
+		g.levels = append(g.levels, level[J]{})
+		copy(g.levels[i+1:], g.levels[i:])
+		g.levels[i] = level[J]{priority: t.priority}
+	}
+
+	if front {
+		g.levels[i].tasks.pushFront(t)
+	} else {
+		g.levels[i].tasks.push(t)
+	}
+
+	g.pending++
+}
+
+// first returns index of the highest priority level
+// whose first task is ok or -1.
+func (g *group[J]) first(ok func(task[J]) bool) int {
+	for i := range g.levels {
+		if ok(g.levels[i].tasks.peek()) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// dequeue removes and returns the first task of the level.
+func (g *group[J]) dequeue(i int) task[J] {
+	t := g.levels[i].tasks.pop()
+
+	if g.levels[i].tasks.len() == 0 {
+		n := i + copy(g.levels[i:], g.levels[i+1:])
+		g.levels[n] = level[J]{}
+		g.levels = g.levels[:n]
+	}
+
+	g.pending--
+
+	return t
+}
+
+// drain removes and returns all the pending tasks.
+func (g *group[J]) drain() []task[J] {
+	tasks := make([]task[J], 0, g.pending)
+
+	for g.pending > 0 {
+		tasks = append(tasks, g.dequeue(0))
+	}
+
+	return tasks
+}
+
+// fifo is a slice backed FIFO queue.
+type fifo[T any] struct {
+	items []T
+	head  int
+}
+
+func (f *fifo[T]) push(item T) {
+	f.items = append(f.items, item)
+}
+
+// pushFront adds item to the beginning.
+func (f *fifo[T]) pushFront(item T) {
+	if f.head > 0 {
+		f.head--
+		f.items[f.head] = item
+		return
+	}
+
+	f.items = append(f.items, item)
+	copy(f.items[1:], f.items[:len(f.items)-1])
+	f.items[0] = item
+}
+
+// peek returns the first item.
+func (f *fifo[T]) peek() T {
+	return f.items[f.head]
+}
+
+func (f *fifo[T]) pop() T {
+	var zero T
+
+	item := f.items[f.head]
+	f.items[f.head] = zero
+	f.head++
+
+	// Reclaim space of popped items.
+	if f.head == len(f.items) {
+		f.items = f.items[:0]
+		f.head = 0
+	} else if f.head > len(f.items)/2 && f.head > 32 {
+		n := copy(f.items, f.items[f.head:])
+		clear(f.items[n:])
+		f.items = f.items[:n]
+		f.head = 0
+	}
+
+	return item
+}
+
+func (f *fifo[T]) len() int {
+	return len(f.items) - f.head
+}
+
+// each calls fn for every item in order.
+func (f *fifo[T]) each(fn func(T)) {
+	for i := f.head; i < len(f.items); i++ {
+		fn(f.items[i])
+	}
+}
+
+type delayedTask[J any] struct {
+	due  time.Time
+	task task[J]
+}
+
+// delayedHeap is a min-heap of delayed tasks by due time.
+type delayedHeap[J any] []delayedTask[J]
+
+func (h delayedHeap[J]) Len() int           { return len(h) }
+func (h delayedHeap[J]) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h delayedHeap[J]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *delayedHeap[J]) Push(x interface{}) {
+	*h = append(*h, x.(delayedTask[J]))
+}
+
+func (h *delayedHeap[J]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
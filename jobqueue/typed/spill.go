@@ -0,0 +1,685 @@
+package typed
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// spillSegment is the maximum number of tasks in a spill segment file.
+const spillSegment = 1 << 14
+
+// ErrSpillLost is the error of spilled jobs which could not be read
+// back, their outcomes have zero jobs, see SetSpill.
+var ErrSpillLost = errors.New("jobqueue: spilled job is lost")
+
+// SetSpill enables spilling jobs to disk: when the pending jobs of
+// a group reach capacity, Schedule does not block, but appends jobs
+// to segment files in a temporary directory created in dir, and they
+// are read back in scheduling order as the pending jobs are taken.
+// Spilled jobs are not reordered by priority until they are read back.
+// Jobs must be serializable with encoding/json. Files are removed when
+// the queue is finished. If spilling fails, Schedule blocks as usual and
+// if spilled jobs can not be read back, the queue is cancelled and the
+// lost jobs get outcomes with ErrSpillLost, see SpillErr.
+// Must be called before Start.
+func (q *Queue[J, R]) SetSpill(dir string) {
+	q.todo.setSpill(dir)
+}
+
+// SpillErr returns the first error of spilling jobs to disk.
+func (q *Queue[J, R]) SpillErr() error {
+	return q.todo.spillError()
+}
+
+// spillRecord is a task encoded in a segment file.
+type spillRecord[J any] struct {
+	Seq      uint64 `json:"seq"`
+	Priority int    `json:"priority"`
+	Job      J      `json:"job"`
+}
+
+// segment is a spill segment file.
+type segment struct {
+	path string
+
+	// base is the index of the first record of the file in the spill.
+	base int
+
+	// count is the number of records in the file, decoded is the number
+	// of records read from the file and read is the number of records
+	// moved back to the scheduler, see spill.commit.
+	count   int
+	decoded int
+	read    int
+}
+
+// spill is an on-disk FIFO of tasks of a group. Tasks are appended
+// to the active segment file, which is sealed when it is full or
+// when it has to be read, sealed segments are read back in order and
+// removed once they are read. It has its own mutex, so files are not
+// accessed under the scheduler mutex, which is never held while
+// waiting for the spill mutex.
+type spill[J any] struct {
+	mu sync.Mutex
+
+	// avail is signalled when tasks are pushed or spill is closed,
+	// turn is signalled when a reserved task is written or spill
+	// is unpinned.
+	avail *sync.Cond
+	turn  *sync.Cond
+
+	dir    string
+	prefix string
+	next   int
+
+	// sealed are the segments to be read, the first ones are being read.
+	sealed []*segment
+	rf     *os.File
+	dec    *json.Decoder
+
+	// active is the segment being written.
+	active *segment
+	wf     *os.File
+	bw     *bufio.Writer
+	enc    *json.Encoder
+
+	// n is the number of tasks which are not decoded yet.
+	n int
+
+	// written is the number of reserved tasks which are written or
+	// failed, tasks are written in order they are reserved, see
+	// scheduler.spillTask. records is the number of written records.
+	written int
+	records int
+
+	// pins is the number of snapshots being taken, read segments
+	// are not removed while it is not zero. Accessed atomically.
+	pins int32
+
+	// closed spill does not get new tasks.
+	closed bool
+}
+
+func newSpill[J any](dir, prefix string) *spill[J] {
+	sp := &spill[J]{dir: dir, prefix: prefix}
+	sp.avail = sync.NewCond(&sp.mu)
+	sp.turn = sync.NewCond(&sp.mu)
+
+	return sp
+}
+
+// write appends task with the given reservation number,
+// it waits for the tasks reserved before.
+func (sp *spill[J]) write(ticket int, t task[J]) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for sp.written != ticket {
+		sp.turn.Wait()
+	}
+
+	err := sp.push(t)
+
+	sp.written++
+	sp.turn.Broadcast()
+
+	return err
+}
+
+// push appends task to the active segment, spill mutex must be held.
+func (sp *spill[J]) push(t task[J]) error {
+	if sp.active == nil {
+		path := filepath.Join(sp.dir, fmt.Sprintf("%s-%06d.jsonl", sp.prefix, sp.next))
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		sp.next++
+		sp.active = &segment{path: path, base: sp.records}
+		sp.wf = f
+		sp.bw = bufio.NewWriter(f)
+		sp.enc = json.NewEncoder(sp.bw)
+	}
+
+	if err := sp.enc.Encode(spillRecord[J]{Seq: t.seq, Priority: t.priority, Job: t.job}); err != nil {
+		// The segment may be corrupted, so it is not written anymore.
+		sp.seal()
+		return err
+	}
+
+	sp.active.count++
+	sp.records++
+	sp.n++
+	sp.avail.Signal()
+
+	if sp.active.count >= spillSegment {
+		return sp.seal()
+	}
+
+	return nil
+}
+
+// seal flushes and closes the active segment, so it can be read.
+func (sp *spill[J]) seal() error {
+	s := sp.active
+	if s == nil {
+		return nil
+	}
+
+	sp.active = nil
+	sp.sealed = append(sp.sealed, s)
+
+	err := sp.bw.Flush()
+	if cerr := sp.wf.Close(); err == nil {
+		err = cerr
+	}
+
+	sp.wf, sp.bw, sp.enc = nil, nil, nil
+
+	return err
+}
+
+// pop reads the first task which is not read yet, it blocks while
+// there are no tasks. It returns false when spill is closed and there
+// are no tasks left. On error the rest of the segment is lost and
+// the number of lost tasks is returned. Read task must be committed
+// before the next pop.
+func (sp *spill[J]) pop() (spillRecord[J], bool, int, error) {
+	var rec spillRecord[J]
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for sp.n == 0 && !sp.closed {
+		sp.avail.Wait()
+	}
+
+	if sp.n == 0 {
+		return rec, false, 0, nil
+	}
+
+	sp.remove()
+
+	if len(sp.sealed) == 0 || sp.sealed[len(sp.sealed)-1].decoded == sp.sealed[len(sp.sealed)-1].count {
+		if err := sp.seal(); err != nil {
+			return rec, false, sp.lose(), err
+		}
+	}
+
+	s := sp.reading()
+
+	if sp.rf == nil {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return rec, false, sp.lose(), err
+		}
+
+		sp.rf = f
+		sp.dec = json.NewDecoder(bufio.NewReader(f))
+	}
+
+	if err := sp.dec.Decode(&rec); err != nil {
+		return rec, false, sp.lose(), err
+	}
+
+	s.decoded++
+	sp.n--
+
+	if s.decoded == s.count {
+		sp.rf.Close()
+		sp.rf, sp.dec = nil, nil
+	}
+
+	return rec, true, 0, nil
+}
+
+// reading returns the first segment with records which are not decoded.
+func (sp *spill[J]) reading() *segment {
+	for _, s := range sp.sealed {
+		if s.decoded < s.count {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// lose skips the rest of the segment being read
+// and returns the number of skipped tasks.
+func (sp *spill[J]) lose() int {
+	s := sp.reading()
+	if s == nil {
+		return 0
+	}
+
+	if sp.rf != nil {
+		sp.rf.Close()
+		sp.rf, sp.dec = nil, nil
+	}
+
+	lost := s.count - s.decoded
+	s.read += lost
+	s.decoded = s.count
+	sp.n -= lost
+
+	return lost
+}
+
+// commit marks the task returned by pop as moved to the scheduler.
+func (sp *spill[J]) commit() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for _, s := range sp.sealed {
+		if s.read < s.decoded {
+			s.read++
+			return
+		}
+	}
+}
+
+// remove removes the segment files which are read
+// unless the spill is pinned.
+func (sp *spill[J]) remove() {
+	if atomic.LoadInt32(&sp.pins) > 0 {
+		return
+	}
+
+	for len(sp.sealed) > 0 && sp.sealed[0].read == sp.sealed[0].count {
+		os.Remove(sp.sealed[0].path)
+		sp.sealed[0] = nil
+		sp.sealed = sp.sealed[1:]
+	}
+}
+
+// pin keeps segment files until unpin, so they can be read without
+// the spill mutex. It does not take the mutex, so it can be called
+// under the scheduler mutex.
+func (sp *spill[J]) pin() {
+	atomic.AddInt32(&sp.pins, 1)
+}
+
+func (sp *spill[J]) unpin() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	atomic.AddInt32(&sp.pins, -1)
+	sp.remove()
+	sp.turn.Broadcast()
+}
+
+// segments waits for the given number of reserved tasks to be written
+// and returns copies of the segments with records from the given index.
+// The spill must be pinned.
+func (sp *spill[J]) segments(from, reserved int) ([]segment, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for sp.written < reserved {
+		sp.turn.Wait()
+	}
+
+	if sp.active != nil {
+		if err := sp.bw.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	segments := sp.sealed
+	if sp.active != nil {
+		segments = append(segments[:len(segments):len(segments)], sp.active)
+	}
+
+	res := make([]segment, 0, len(segments))
+
+	for _, s := range segments {
+		if s.base+s.count > from {
+			res = append(res, *s)
+		}
+	}
+
+	return res, nil
+}
+
+// eachRecord calls fn for every record of the segment file
+// with its index in the spill.
+func eachRecord[J any](s segment, fn func(int, spillRecord[J])) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+
+	for i := 0; i < s.count; i++ {
+		var rec spillRecord[J]
+
+		if err := dec.Decode(&rec); err != nil {
+			return err
+		}
+
+		fn(s.base+i, rec)
+	}
+
+	return nil
+}
+
+// close tells that there will be no new tasks.
+func (sp *spill[J]) close() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.closed = true
+	sp.avail.Broadcast()
+}
+
+// clean closes and removes all the segment files,
+// it waits for snapshots to unpin the spill.
+func (sp *spill[J]) clean() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for atomic.LoadInt32(&sp.pins) > 0 {
+		sp.turn.Wait()
+	}
+
+	sp.seal()
+
+	if sp.rf != nil {
+		sp.rf.Close()
+		sp.rf, sp.dec = nil, nil
+	}
+
+	for _, s := range sp.sealed {
+		os.Remove(s.path)
+	}
+
+	sp.sealed = nil
+}
+
+// setSpill enables spilling tasks to a temporary directory
+// created in dir, see SetSpill.
+func (s *scheduler[J]) setSpill(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spillFailed = make(chan struct{})
+
+	tmp, err := os.MkdirTemp(dir, "jobqueue-spill-")
+	if err != nil {
+		s.spillErr = err
+		return
+	}
+
+	s.spillTmp = tmp
+}
+
+// spillable returns true if tasks of the group go to disk:
+// the group is full or there are spilled tasks already.
+func (s *scheduler[J]) spillable(g *group[J]) bool {
+	if s.spillTmp == "" || s.spillErr != nil {
+		return false
+	}
+
+	return g.pending >= s.capacity || g.spilled > 0
+}
+
+// spill returns spill of the group and starts its reader
+// if required. Scheduler mutex must be held.
+func (s *scheduler[J]) spill(g *group[J]) *spill[J] {
+	if g.spill == nil {
+		g.spill = newSpill[J](s.spillTmp, fmt.Sprintf("group%d", g.id))
+
+		s.spillWG.Add(1)
+		go s.reader(g)
+	}
+
+	return g.spill
+}
+
+// spillTask appends task to its group spill. It is called with
+// scheduler mutex held and releases it: the place of the task is
+// reserved under the scheduler mutex, so tasks are written in order,
+// but the spill is written without the scheduler mutex.
+func (s *scheduler[J]) spillTask(t task[J]) {
+	g := t.group
+	sp := s.spill(g)
+
+	ticket := g.reserved
+	g.reserved++
+	g.spilled++
+
+	s.mu.Unlock()
+
+	err := sp.write(ticket, t)
+	if err == nil {
+		return
+	}
+
+	// Spilling is disabled, the task is kept in memory.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g.spilled--
+	s.setSpillErr(err)
+	s.enqueue(t, false)
+}
+
+// reader moves spilled tasks of the group back to the scheduler
+// when the group has space for them. Tasks of cancelled group are
+// dropped and tasks of aborted scheduler are cancelled.
+func (s *scheduler[J]) reader(g *group[J]) {
+	defer s.spillWG.Done()
+
+	sp := g.spill
+
+	for {
+		// Tasks are read only when they fit, so files are not read
+		// ahead while the group is full.
+		s.mu.Lock()
+		for g.pending >= s.capacity && !s.aborted && !g.cancelled {
+			g.space.Wait()
+		}
+		s.mu.Unlock()
+
+		rec, ok, lost, err := sp.pop()
+
+		if err != nil {
+			s.mu.Lock()
+			g.spilled -= lost
+			g.unspilled += lost
+			g.lost += lost
+			s.failSpill(err)
+			s.ready.Broadcast()
+			s.mu.Unlock()
+			continue
+		}
+
+		if !ok {
+			return
+		}
+
+		t := task[J]{job: rec.Job, seq: rec.Seq, group: g, priority: rec.Priority}
+
+		s.mu.Lock()
+
+		g.spilled--
+		g.unspilled++
+
+		switch {
+		case s.aborted:
+			s.cancelled = append(s.cancelled, t)
+		case g.cancelled:
+			g.cancelledJobs = append(g.cancelledJobs, t.job)
+			t.dropped = true
+			s.dropped.push(t)
+			s.ready.Signal()
+		default:
+			s.enqueue(t, false)
+		}
+
+		if s.finished() {
+			s.ready.Broadcast()
+		}
+
+		s.mu.Unlock()
+
+		// Snapshot finds the task in memory by unspilled count,
+		// so it is committed without the scheduler mutex.
+		sp.commit()
+	}
+}
+
+// spilled returns the number of spilled tasks.
+func (s *scheduler[J]) spilled() int {
+	n := 0
+
+	for _, g := range s.groups {
+		n += g.spilled
+	}
+
+	return n
+}
+
+// spills returns spills of all the groups, scheduler mutex must be held.
+func (s *scheduler[J]) spills() []*spill[J] {
+	spills := make([]*spill[J], 0)
+
+	for _, g := range s.groups {
+		if g.spill != nil {
+			spills = append(spills, g.spill)
+		}
+	}
+
+	return spills
+}
+
+// closeSpills tells readers that there will be no new tasks, it must be
+// called without scheduler mutex with spills taken under the mutex.
+func closeSpills[J any](spills []*spill[J]) {
+	for _, sp := range spills {
+		sp.close()
+	}
+}
+
+// waitSpill waits for all the spilled tasks to be read back.
+func (s *scheduler[J]) waitSpill() {
+	s.spillWG.Wait()
+}
+
+func (s *scheduler[J]) setSpillErr(err error) {
+	if s.spillErr == nil {
+		s.spillErr = err
+	}
+}
+
+// failSpill records error of reading back spilled tasks
+// and closes spillFailed.
+func (s *scheduler[J]) failSpill(err error) {
+	s.setSpillErr(err)
+
+	select {
+	case <-s.spillFailed:
+	default:
+		close(s.spillFailed)
+	}
+}
+
+// spillError returns the first spill error.
+func (s *scheduler[J]) spillError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.spillErr
+}
+
+// lostTasks returns the number of spilled tasks which could
+// not be read back by group.
+func (s *scheduler[J]) lostTasks() map[*group[J]]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lost := make(map[*group[J]]int)
+
+	for _, g := range s.groups {
+		if g.lost > 0 {
+			lost[g] = g.lost
+		}
+	}
+
+	return lost
+}
+
+// cleanSpill removes all the spill files,
+// it must be called after waitSpill.
+func (s *scheduler[J]) cleanSpill() {
+	s.mu.Lock()
+	tmp := s.spillTmp
+	spills := s.spills()
+	s.mu.Unlock()
+
+	if tmp == "" {
+		return
+	}
+
+	for _, sp := range spills {
+		sp.clean()
+	}
+
+	if err := os.RemoveAll(tmp); err != nil {
+		s.mu.Lock()
+		s.setSpillErr(err)
+		s.mu.Unlock()
+	}
+}
+
+// spillView is a part of group spill to be included in snapshot.
+type spillView[J any] struct {
+	sp *spill[J]
+
+	// from is the index of the first record which is not read back,
+	// reserved is the number of tasks reserved in the spill.
+	from     int
+	reserved int
+}
+
+// view pins the spill of the group and returns the part of it which
+// is not read back, scheduler mutex must be held.
+func (s *scheduler[J]) view(g *group[J]) spillView[J] {
+	g.spill.pin()
+
+	return spillView[J]{sp: g.spill, from: g.unspilled, reserved: g.reserved}
+}
+
+// each calls fn for every record of the view which was pushed before
+// the task with the given sequence number and unpins the spill.
+func (v spillView[J]) each(seq uint64, fn func(spillRecord[J])) error {
+	defer v.sp.unpin()
+
+	segments, err := v.sp.segments(v.from, v.reserved)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range segments {
+		err := eachRecord(s, func(i int, rec spillRecord[J]) {
+			if i >= v.from && rec.Seq < seq {
+				fn(rec)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
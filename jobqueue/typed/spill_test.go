@@ -0,0 +1,408 @@
+package typed_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// spillFiles returns files in spill directories of dir.
+func spillFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	require.NoError(t, err)
+
+	return files
+}
+
+// slowJob is a job whose decoding waits for slowUnblock,
+// so reading spilled jobs back can be held by tests.
+type slowJob int
+
+var slowDecoding, slowUnblock chan struct{}
+
+func (j *slowJob) UnmarshalJSON(b []byte) error {
+	select {
+	case slowDecoding <- struct{}{}:
+	default:
+	}
+
+	<-slowUnblock
+
+	return json.Unmarshal(b, (*int)(j))
+}
+
+func TestQueue_SetSpill(t *testing.T) {
+	const jobs = 40000
+
+	dir := t.TempDir()
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 10)
+	q.SetSpill(dir)
+
+	outcomes := q.Outcomes()
+
+	// Scheduling does not block without workers.
+	q.Add(jobs)
+	for j := 0; j < jobs; j++ {
+		q.Schedule(j)
+	}
+
+	s := q.Stats()
+	assert.Equal(t, jobs, s.Queued)
+	assert.Equal(t, jobs-10, s.Spilled)
+	assert.Len(t, spillFiles(t, dir), 3)
+
+	cp := q.Checkpoint()
+	if assert.Len(t, cp.Jobs, jobs) {
+		for i, j := range cp.Jobs {
+			assert.Equal(t, i, j)
+		}
+	}
+
+	q.Start(context.Background())
+	q.Stop()
+
+	next := 0
+	for o := range outcomes {
+		assert.NoError(t, o.Err)
+		assert.Equal(t, next, o.Job)
+		next++
+	}
+
+	assert.Equal(t, jobs, next)
+	assert.NoError(t, q.SpillErr())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestQueue_SetSpillCancel(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 10)
+	q.SetSpill(dir)
+
+	q.Add(100)
+	for j := 0; j < 100; j++ {
+		q.Schedule(j)
+	}
+
+	q.Start(ctx)
+	waitDone(t, q)
+
+	assert.Len(t, q.Cancelled(), 100)
+	assert.Empty(t, spillFiles(t, dir))
+}
+
+func TestQueue_SetSpillGroups(t *testing.T) {
+	dir := t.TempDir()
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 2, 5)
+	q.SetSpill(dir)
+
+	g := q.Group("tenant", 1)
+	g.Add(100)
+	for j := 0; j < 100; j++ {
+		g.Schedule(j)
+	}
+
+	assert.Equal(t, 100, g.Stats().Queued)
+	assert.Equal(t, 95, q.Stats().Spilled)
+
+	g.Cancel()
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	q.Add(50)
+	for j := 0; j < 50; j++ {
+		q.Schedule(j)
+	}
+
+	q.Stop()
+
+	processed, cancelled := 0, 0
+
+	for o := range outcomes {
+		if errors.Is(o.Err, context.Canceled) {
+			cancelled++
+			continue
+		}
+
+		assert.NoError(t, o.Err)
+		processed++
+	}
+
+	assert.Equal(t, 50, processed)
+	assert.Equal(t, 100, cancelled)
+	assert.Len(t, g.Cancelled(), 100)
+}
+
+func TestQueue_SetSpillCancelFromConsumer(t *testing.T) {
+	dir := t.TempDir()
+
+	// Jobs after the first one wait for the group to be cancelled.
+	q := typed.New[int, int](typed.ContextProcessorFunc[int, int](func(ctx context.Context, j int) (int, bool, error) {
+		if j > 0 {
+			<-ctx.Done()
+			return 0, false, ctx.Err()
+		}
+		return j, false, nil
+	}), 1, 10)
+	q.SetSpill(dir)
+
+	outcomes := q.Outcomes()
+
+	g := q.Group("tenant", 1)
+	g.Add(100)
+	for j := 0; j < 100; j++ {
+		g.Schedule(j)
+	}
+
+	q.Start(context.Background())
+	q.Stop()
+
+	done := make(chan int)
+
+	go func() {
+		cancelled := 0
+
+		for o := range outcomes {
+			// Spilled jobs do not fit in outcomes buffer.
+			if o.Job == 0 {
+				g.Cancel()
+			}
+
+			if errors.Is(o.Err, context.Canceled) {
+				cancelled++
+			}
+		}
+
+		done <- cancelled
+	}()
+
+	select {
+	case cancelled := <-done:
+		assert.Equal(t, 99, cancelled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel from consumer is blocked")
+	}
+
+	assert.Equal(t, uint64(100), g.Stats().Processed)
+	assert.NoError(t, q.SpillErr())
+	assert.Empty(t, spillFiles(t, dir))
+}
+
+func TestQueue_SetSpillSlowRead(t *testing.T) {
+	slowDecoding, slowUnblock = make(chan struct{}, 1), make(chan struct{})
+
+	q := typed.New[slowJob, int](typed.ProcessorFunc[slowJob, int](func(j slowJob) (int, bool, error) {
+		return int(j), false, nil
+	}), 1, 10)
+	q.SetSpill(t.TempDir())
+
+	outcomes := q.Outcomes()
+
+	q.Add(21)
+	for j := 0; j < 20; j++ {
+		q.Schedule(slowJob(j))
+	}
+
+	q.Start(context.Background())
+
+	select {
+	case <-slowDecoding:
+	case <-time.After(5 * time.Second):
+		t.Fatal("spilled jobs are not read back")
+	}
+
+	// The job is spilled while the segment is being read.
+	scheduled := make(chan struct{})
+	go func() {
+		q.Schedule(20)
+		close(scheduled)
+	}()
+
+	// Jobs in memory are processed while the read is held.
+	processed := 0
+	for processed < 10 {
+		select {
+		case <-outcomes:
+			processed++
+		case <-time.After(5 * time.Second):
+			t.Fatal("workers are blocked by spill read")
+		}
+	}
+
+	// Stats are available while the scheduled job waits for the read.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		stats := make(chan typed.Stats, 1)
+		go func() {
+			stats <- q.Stats()
+		}()
+
+		var s typed.Stats
+
+		select {
+		case s = <-stats:
+		case <-time.After(5 * time.Second):
+			t.Fatal("stats are blocked by spill read")
+		}
+
+		if s.Spilled == 11 {
+			assert.Equal(t, uint64(10), s.Processed)
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("job is not spilled")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	close(slowUnblock)
+	<-scheduled
+
+	q.Stop()
+
+	for range outcomes {
+		processed++
+	}
+
+	assert.Equal(t, 21, processed)
+	assert.NoError(t, q.SpillErr())
+}
+
+func TestQueue_SetSpillCheckpoint(t *testing.T) {
+	release := make(chan struct{})
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j == 0 {
+			<-release
+		}
+		return j, false, nil
+	}), 1, 10)
+	q.SetSpill(t.TempDir())
+
+	outcomes := q.Outcomes()
+
+	q.Add(30)
+	for j := 0; j < 30; j++ {
+		q.Schedule(j)
+	}
+
+	q.Start(context.Background())
+
+	// The first spilled job is read back when the first job is taken.
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().Spilled != 19 {
+		if time.Now().After(deadline) {
+			t.Fatal("spilled job is not read back")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cp := q.Checkpoint()
+	if assert.Len(t, cp.Jobs, 30) {
+		for i, j := range cp.Jobs {
+			assert.Equal(t, i, j)
+		}
+	}
+
+	close(release)
+	q.Stop()
+
+	count := 0
+	for range outcomes {
+		count++
+	}
+
+	assert.Equal(t, 30, count)
+	assert.NoError(t, q.SpillErr())
+}
+
+func TestQueue_SetSpillWriteError(t *testing.T) {
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 2, 5)
+	q.SetSpill(filepath.Join(t.TempDir(), "missing"))
+
+	outcomes := q.Outcomes()
+	q.Start(context.Background())
+
+	// Scheduling falls back to blocking, so outcomes are read concurrently.
+	go func() {
+		q.Add(100)
+		for j := 0; j < 100; j++ {
+			q.Schedule(j)
+		}
+		q.Stop()
+	}()
+
+	count := 0
+	for o := range outcomes {
+		assert.NoError(t, o.Err)
+		count++
+	}
+
+	assert.Equal(t, 100, count)
+	assert.Error(t, q.SpillErr())
+}
+
+func TestQueue_SetSpillReadError(t *testing.T) {
+	dir := t.TempDir()
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](identity), 1, 10)
+	q.SetSpill(dir)
+
+	outcomes := q.Outcomes()
+
+	q.Add(100)
+	for j := 0; j < 100; j++ {
+		q.Schedule(j)
+	}
+
+	for _, f := range spillFiles(t, dir) {
+		require.NoError(t, os.Remove(f))
+	}
+
+	q.Start(context.Background())
+	q.Stop()
+
+	count, lost := 0, 0
+	for o := range outcomes {
+		switch {
+		case errors.Is(o.Err, typed.ErrSpillLost):
+			assert.Equal(t, 0, o.Job)
+			lost++
+		case o.Err != nil:
+			assert.True(t, errors.Is(o.Err, context.Canceled))
+		}
+		count++
+	}
+
+	// Jobs in memory are processed or cancelled, spilled ones are lost.
+	assert.Equal(t, 100, count)
+	assert.Equal(t, 90, lost)
+	assert.Error(t, q.SpillErr())
+
+	s := q.Stats()
+	assert.Equal(t, uint64(100), s.Processed)
+	assert.True(t, s.Failed >= 90)
+
+	q.WaitJobs()
+}
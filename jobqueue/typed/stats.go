@@ -0,0 +1,169 @@
+package typed
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the queue statistics.
+type Stats struct {
+	// State is the queue state.
+	State State
+
+	// Jobs is the expected number of jobs, see Add.
+	Jobs uint64
+
+	// Processed is the number of processed jobs, including failed ones.
+	Processed uint64
+
+	// Queued is the number of jobs waiting to be processed,
+	// including the ones delayed before retry.
+	Queued int
+
+	// Spilled is the number of queued jobs spilled to disk, see SetSpill.
+	Spilled int
+
+	// InFlight is the number of jobs being processed.
+	InFlight int
+
+	// Errors is the number of attempts failed with an error.
+	// Jobs failed fast by open circuit breakers are not attempted,
+	// so they are counted in Rejected instead.
+	Errors uint64
+
+	// Failed is the number of processed jobs failed with an error,
+	// including rejected ones.
+	Failed uint64
+
+	// Rejected is the number of jobs failed fast with ErrBreakerOpen,
+	// see SetBreaker.
+	Rejected uint64
+
+	// Retries is the number of retried attempts.
+	Retries uint64
+
+	// Timeouts is the number of attempts which exceeded timeout,
+	// see SetTimeout.
+	Timeouts uint64
+
+	// Panics is the number of attempts whose processor panicked.
+	Panics uint64
+
+	// Duplicates is the number of skipped duplicate jobs, see SetDedup.
+	Duplicates uint64
+
+	// Throttled is the number of times jobs were delayed
+	// by rate limits, see SetRateLimit.
+	Throttled uint64
+
+	// Tripped is the number of times jobs were failed fast or
+	// deferred by open circuit breakers, see SetBreaker.
+	Tripped uint64
+
+	// RateLimit is the global rate limit.
+	RateLimit Limit
+
+	// KeyRateLimit is the default per-key rate limit.
+	KeyRateLimit Limit
+
+	// Elapsed is time since the queue is created without pauses.
+	Elapsed time.Duration
+
+	// Rate is exponentially weighted number of processed jobs per second,
+	// see RateWindow.
+	Rate float64
+
+	// ETA is estimated time until all the expected jobs are processed.
+	// It is zero if rate is unknown yet.
+	ETA time.Duration
+}
+
+// Progress returns ratio of processed jobs to expected jobs.
+func (s Stats) Progress() float64 {
+	if s.Jobs == 0 {
+		return 0
+	}
+
+	return float64(s.Processed) / float64(s.Jobs)
+}
+
+// RateWindow is the time constant of Stats.Rate averaging:
+// older samples weigh e times less every RateWindow.
+const RateWindow = 10 * time.Second
+
+// minRateSample is minimal interval between rate samples,
+// more frequent polling returns the previous rate.
+const minRateSample = 100 * time.Millisecond
+
+// rateMeter is exponentially weighted moving average of jobs rate.
+type rateMeter struct {
+	mu        sync.Mutex
+	rate      float64
+	processed uint64
+	at        time.Duration
+	warm      bool
+}
+
+// update adds sample of the processed number at the elapsed time
+// and returns the current rate.
+func (m *rateMeter) update(processed uint64, elapsed time.Duration) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dt := elapsed - m.at
+	if dt < minRateSample {
+		return m.rate
+	}
+
+	sample := float64(processed-m.processed) / dt.Seconds()
+
+	// Until the first window passes the average rate is the best estimate.
+	if !m.warm {
+		m.rate = float64(processed) / elapsed.Seconds()
+		m.warm = elapsed >= RateWindow
+	} else {
+		alpha := 1 - math.Exp(-float64(dt)/float64(RateWindow))
+		m.rate += alpha * (sample - m.rate)
+	}
+
+	m.processed, m.at = processed, elapsed
+
+	return m.rate
+}
+
+// Stats returns snapshot of the queue statistics,
+// it is safe to call from any goroutine.
+func (q *Queue[J, R]) Stats() Stats {
+	queued, spilled, inflight := q.todo.counts()
+
+	s := Stats{
+		State:      q.State(),
+		Jobs:       atomic.LoadUint64(&q.jobsCount),
+		Processed:  atomic.LoadUint64(&q.jobsProcessed),
+		Queued:     queued,
+		Spilled:    spilled,
+		InFlight:   inflight,
+		Errors:     atomic.LoadUint64(&q.failures),
+		Failed:     atomic.LoadUint64(&q.failed),
+		Rejected:   atomic.LoadUint64(&q.rejected),
+		Retries:    atomic.LoadUint64(&q.retries),
+		Timeouts:   atomic.LoadUint64(&q.timeouts),
+		Panics:     atomic.LoadUint64(&q.panics),
+		Duplicates: atomic.LoadUint64(&q.duplicates),
+		Throttled:  atomic.LoadUint64(&q.throttled),
+		Tripped:    atomic.LoadUint64(&q.tripped),
+		Elapsed:    q.elapsed(),
+	}
+
+	s.RateLimit, s.KeyRateLimit = q.limiter.limits()
+
+	s.Rate = q.rate.update(s.Processed, s.Elapsed)
+
+	if s.Rate > 0 && s.Jobs > s.Processed {
+		s.ETA = time.Duration(float64(s.Jobs-s.Processed) / s.Rate * float64(time.Second))
+	}
+
+	return s
+}
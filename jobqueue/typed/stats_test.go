@@ -0,0 +1,100 @@
+package typed_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/russtone/utils/jobqueue/typed"
+)
+
+// waitProcessed waits for the given number of processed jobs.
+// It polls Stats itself, because assert.Eventually of the testify
+// version in use may panic when the condition outlives it.
+func waitProcessed(t *testing.T, q *typed.Queue[int, int], n uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if q.Stats().Processed == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("%d jobs are not processed", n)
+}
+
+func TestQueue_Stats(t *testing.T) {
+	release := make(chan struct{})
+
+	proc := newProcessor(1, 2)
+
+	q := typed.New[int, int](typed.ProcessorFunc[int, int](func(j int) (int, bool, error) {
+		if j == 0 {
+			<-release
+		}
+		return proc.Process(j)
+	}), 2, 100)
+
+	s := q.Stats()
+	assert.Equal(t, typed.StateNew, s.State)
+	assert.Equal(t, float64(0), s.Progress())
+	assert.Equal(t, float64(0), q.Progress())
+
+	q.Start(context.Background())
+
+	go func() {
+		var err error
+		for q.Err(&err) {
+		}
+	}()
+
+	go func() {
+		var res int
+		for q.Next(&res) {
+		}
+	}()
+
+	q.Add(100)
+	q.Pause()
+
+	for j := 0; j < 100; j++ {
+		q.Schedule(j)
+	}
+
+	s = q.Stats()
+	assert.Equal(t, typed.StatePaused, s.State)
+	assert.Equal(t, uint64(100), s.Jobs)
+	assert.Equal(t, 100, s.Queued)
+	assert.Equal(t, 0, s.InFlight)
+
+	q.Resume()
+
+	// Job 0 is blocked, the rest is processed by the other worker.
+	waitProcessed(t, q, 99)
+
+	s = q.Stats()
+	assert.Equal(t, 1, s.InFlight)
+	assert.Equal(t, 0, s.Queued)
+	assert.Equal(t, uint64(1), s.Errors)
+	assert.Equal(t, uint64(2), s.Retries)
+	assert.True(t, s.Elapsed > 0)
+
+	time.Sleep(150 * time.Millisecond)
+
+	s = q.Stats()
+	assert.True(t, s.Rate > 0)
+	assert.True(t, s.ETA > 0)
+
+	close(release)
+	q.WaitJobs()
+	q.Stop()
+	waitDone(t, q)
+
+	s = q.Stats()
+	assert.Equal(t, typed.StateStopped, s.State)
+	assert.Equal(t, float64(1), s.Progress())
+	assert.Equal(t, time.Duration(0), s.ETA)
+}